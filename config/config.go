@@ -3,10 +3,14 @@ package config
 import (
 	"log"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
+// DefaultAllowedImageTypePattern 是 AllowedImageTypePattern 的默认值，匹配魔数嗅探支持的常见图片 MIME 类型
+const DefaultAllowedImageTypePattern = `^image/(jpeg|png|gif|webp|avif|bmp|tiff|heic)$`
+
 // Config 存储应用程序配置
 type Config struct {
 	// 服务器配置
@@ -21,12 +25,14 @@ type Config struct {
 	LocalStoragePath string
 
 	// S3 存储配置
-	S3Endpoint   string
-	S3Region     string
-	S3AccessKey  string
-	S3SecretKey  string
-	S3Bucket     string
-	CustomDomain string
+	S3Endpoint     string
+	S3Region       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3Bucket       string
+	CustomDomain   string
+	S3UploadPrefix string
+	S3PresignTTL   int // GetURL 返回限时签名地址的有效期（秒），0 表示返回公开地址
 
 	// FTP 存储配置
 	FTPHost     string
@@ -35,6 +41,21 @@ type Config struct {
 	FTPPassword string
 	FTPPath     string
 
+	// MongoDB GridFS 存储配置
+	MongoURI    string
+	MongoDB     string
+	MongoBucket string
+
+	// 阿里云 OSS 存储配置
+	OSSEndpoint        string
+	OSSRegion          string
+	OSSAccessKeyID     string
+	OSSAccessKeySecret string
+	OSSBucket          string
+	OSSCustomDomain    string
+	OSSUploadPrefix    string
+	OSSCallbackURL     string
+
 	// 图像处理配置
 	MaxUploadSize     int64
 	MaxUploadCount    int
@@ -43,6 +64,12 @@ type Config struct {
 	CompressionEffort int
 	ForceLossless     bool
 
+	// 上传内容类型白名单（正则），用于校验魔数嗅探出的真实 MIME 类型，而非信任扩展名
+	AllowedImageTypePattern string
+
+	// 批量下载配置
+	MaxArchiveSize int64
+
 	// 安全配置
 	AllowedOrigins []string
 	JWTSecret      string
@@ -55,6 +82,9 @@ type Config struct {
 	EnableAutoClean     bool
 	EnableNSFWDetection bool
 
+	// 垃圾回收配置
+	GCIntervalMinutes int
+
 	// 水印配置
 	WatermarkType      string
 	WatermarkText      string
@@ -72,6 +102,15 @@ type Config struct {
 	// 日志配置
 	LogLevel string
 	LogFile  string
+
+	// 链路追踪配置
+	EnableTracing        bool
+	OTELExporterEndpoint string
+
+	// Kafka 事件流配置
+	KafkaEnabled     bool
+	KafkaBrokers     string
+	KafkaTopicPrefix string
 }
 
 // LoadConfig 从环境变量加载配置
@@ -89,12 +128,14 @@ func LoadConfig() *Config {
 		LocalStoragePath: getEnv("LOCAL_STORAGE_PATH", "static/images"),
 
 		// S3 存储配置
-		S3Endpoint:   getEnv("S3_ENDPOINT", ""),
-		S3Region:     getEnv("S3_REGION", ""),
-		S3AccessKey:  getEnv("S3_ACCESS_KEY", ""),
-		S3SecretKey:  getEnv("S3_SECRET_KEY", ""),
-		S3Bucket:     getEnv("S3_BUCKET", ""),
-		CustomDomain: getEnv("CUSTOM_DOMAIN", ""),
+		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		S3Region:       getEnv("S3_REGION", ""),
+		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+		S3Bucket:       getEnv("S3_BUCKET", ""),
+		CustomDomain:   getEnv("CUSTOM_DOMAIN", ""),
+		S3UploadPrefix: getEnv("S3_UPLOAD_PREFIX", "uploads/"),
+		S3PresignTTL:   getEnvInt("S3_PRESIGN_TTL", 0),
 
 		// FTP 存储配置
 		FTPHost:     getEnv("FTP_HOST", ""),
@@ -103,6 +144,21 @@ func LoadConfig() *Config {
 		FTPPassword: getEnv("FTP_PASSWORD", ""),
 		FTPPath:     getEnv("FTP_PATH", ""),
 
+		// MongoDB GridFS 存储配置
+		MongoURI:    getEnv("MONGO_URI", ""),
+		MongoDB:     getEnv("MONGO_DB", "infiniteimages"),
+		MongoBucket: getEnv("MONGO_BUCKET", "images"),
+
+		// 阿里云 OSS 存储配置
+		OSSEndpoint:        getEnv("OSS_ENDPOINT", ""),
+		OSSRegion:          getEnv("OSS_REGION", ""),
+		OSSAccessKeyID:     getEnv("OSS_ACCESS_KEY_ID", ""),
+		OSSAccessKeySecret: getEnv("OSS_ACCESS_KEY_SECRET", ""),
+		OSSBucket:          getEnv("OSS_BUCKET", ""),
+		OSSCustomDomain:    getEnv("OSS_CUSTOM_DOMAIN", ""),
+		OSSUploadPrefix:    getEnv("OSS_UPLOAD_PREFIX", "uploads/"),
+		OSSCallbackURL:     getEnv("OSS_CALLBACK_URL", ""),
+
 		// 图像处理配置
 		MaxUploadSize:     getEnvInt64("MAX_UPLOAD_SIZE", 10*1024*1024), // 默认 10MB
 		MaxUploadCount:    getEnvInt("MAX_UPLOAD_COUNT", 20),
@@ -111,6 +167,11 @@ func LoadConfig() *Config {
 		CompressionEffort: getEnvInt("COMPRESSION_EFFORT", 6),
 		ForceLossless:     getEnvBool("FORCE_LOSSLESS", false),
 
+		AllowedImageTypePattern: getEnv("ALLOWED_IMAGE_TYPE_REGEX", DefaultAllowedImageTypePattern),
+
+		// 批量下载配置
+		MaxArchiveSize: getEnvInt64("MAX_ARCHIVE_SIZE", 500*1024*1024), // 默认 500MB
+
 		// 安全配置
 		AllowedOrigins: getEnvStringSlice("ALLOWED_ORIGINS", []string{"*"}),
 		JWTSecret:      getEnv("JWT_SECRET", ""),
@@ -123,6 +184,9 @@ func LoadConfig() *Config {
 		EnableAutoClean:     getEnvBool("ENABLE_AUTO_CLEAN", true),
 		EnableNSFWDetection: getEnvBool("ENABLE_NSFW_DETECTION", false),
 
+		// 垃圾回收配置
+		GCIntervalMinutes: getEnvInt("GC_INTERVAL_MINUTES", 60),
+
 		// 水印配置
 		WatermarkType:      getEnv("WATERMARK_TYPE", "text"),
 		WatermarkText:      getEnv("WATERMARK_TEXT", "InfiniteImages"),
@@ -140,6 +204,15 @@ func LoadConfig() *Config {
 		// 日志配置
 		LogLevel: getEnv("LOG_LEVEL", "info"),
 		LogFile:  getEnv("LOG_FILE", "logs/app.log"),
+
+		// 链路追踪配置
+		EnableTracing:        getEnvBool("ENABLE_TRACING", false),
+		OTELExporterEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+
+		// Kafka 事件流配置
+		KafkaEnabled:     getEnvBool("KAFKA_ENABLED", false),
+		KafkaBrokers:     getEnv("KAFKA_BROKERS", ""),
+		KafkaTopicPrefix: getEnv("KAFKA_TOPIC_PREFIX", "infiniteimages."),
 	}
 
 	// 验证配置
@@ -151,7 +224,7 @@ func LoadConfig() *Config {
 // validate 验证配置的有效性
 func (c *Config) validate() {
 	// 验证存储类型
-	if c.StorageType != "local" && c.StorageType != "s3" && c.StorageType != "ftp" {
+	if c.StorageType != "local" && c.StorageType != "s3" && c.StorageType != "ftp" && c.StorageType != "gridfs" && c.StorageType != "oss" {
 		log.Printf("警告: 无效的存储类型 '%s'，使用默认值 'local'", c.StorageType)
 		c.StorageType = "local"
 	}
@@ -170,6 +243,21 @@ func (c *Config) validate() {
 		}
 	}
 
+	// 验证 MongoDB GridFS 配置
+	if c.StorageType == "gridfs" {
+		if c.MongoURI == "" {
+			log.Fatal("错误: 使用 GridFS 存储时必须提供 MONGO_URI")
+		}
+		log.Printf("提示: GridFS 存储未自动创建索引，建议手动在 %s.files 集合上为 metadata.hasExpiry/metadata.expiresAt 建立 TTL 索引以加速过期清理", c.MongoBucket)
+	}
+
+	// 验证阿里云 OSS 配置
+	if c.StorageType == "oss" {
+		if c.OSSEndpoint == "" || c.OSSAccessKeyID == "" || c.OSSAccessKeySecret == "" || c.OSSBucket == "" {
+			log.Fatal("错误: 使用 OSS 存储时必须提供 OSS_ENDPOINT, OSS_ACCESS_KEY_ID, OSS_ACCESS_KEY_SECRET 和 OSS_BUCKET")
+		}
+	}
+
 	// 验证图像质量
 	if c.ImageQuality < 1 || c.ImageQuality > 100 {
 		log.Printf("警告: 无效的图像质量 %d，使用默认值 80", c.ImageQuality)
@@ -182,6 +270,17 @@ func (c *Config) validate() {
 		c.CompressionEffort = 6
 	}
 
+	// 验证上传内容类型白名单正则
+	if _, err := regexp.Compile(c.AllowedImageTypePattern); err != nil {
+		log.Printf("警告: 无效的 ALLOWED_IMAGE_TYPE_REGEX '%s'，使用默认值: %v", c.AllowedImageTypePattern, err)
+		c.AllowedImageTypePattern = DefaultAllowedImageTypePattern
+	}
+
+	// 验证 Kafka 事件流配置
+	if c.KafkaEnabled && c.KafkaBrokers == "" {
+		log.Fatal("错误: 启用 Kafka 事件流时必须提供 KAFKA_BROKERS")
+	}
+
 	// 验证水印配置
 	if c.EnableWatermark {
 		if c.WatermarkType != "text" && c.WatermarkType != "image" {
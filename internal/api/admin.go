@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// GCHandler 手动触发一次孤立文件/元数据回收
+func GCHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		blobsRemoved, metadataRemoved, err := store.CleanOrphans()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "垃圾回收失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "垃圾回收完成",
+			"data": gin.H{
+				"blobsRemoved":    blobsRemoved,
+				"metadataRemoved": metadataRemoved,
+			},
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// validImageIDPattern 匹配 generateID 产生的图片ID格式（纯数字时间戳）。
+// 归档接口的 id 来自请求体而非 URL 路径段，必须显式校验，
+// 否则可能被构造成 "../../../etc/passwd" 之类的值传入 filepath.Join/Glob
+var validImageIDPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// isValidImageID 校验 id 是否符合图片ID格式，拒绝任何可能被用于路径穿越的输入
+func isValidImageID(id string) bool {
+	return validImageIDPattern.MatchString(id)
+}
+
+// ArchiveRequest 表示批量归档下载请求
+type ArchiveRequest struct {
+	IDs    []string `json:"ids"`
+	Format string   `json:"format"` // original/webp/avif，默认 original
+	Tag    string   `json:"tag"`    // 可选，按标签筛选追加的图片
+}
+
+// archiveManifestEntry 记录归档中每个条目的处理结果
+type archiveManifestEntry struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ArchiveHandler 处理批量 ZIP 归档下载请求
+func ArchiveHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ArchiveRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求体",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		format := storage.ImageFormat(req.Format)
+		if format == "" {
+			format = storage.Original
+		}
+
+		ids := req.IDs
+		if req.Tag != "" {
+			images, err := store.List()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "获取图片列表失败",
+					"error":   err.Error(),
+				})
+				return
+			}
+			seen := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				seen[id] = true
+			}
+			for _, img := range images {
+				for _, t := range img.Tags {
+					if t == req.Tag {
+						if !seen[img.ID] {
+							ids = append(ids, img.ID)
+							seen[img.ID] = true
+						}
+						break
+					}
+				}
+			}
+		}
+
+		if len(ids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "未指定任何图片ID",
+			})
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", "attachment; filename=\"images.zip\"")
+
+		zw := zip.NewWriter(c.Writer)
+		defer zw.Close()
+
+		var manifest []archiveManifestEntry
+		var totalSize int64
+
+		for _, id := range ids {
+			if !isValidImageID(id) {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "invalid", Error: "非法的图片ID"})
+				continue
+			}
+
+			info, err := store.GetInfo(id)
+			if err != nil {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "missing", Error: "图片信息不存在"})
+				continue
+			}
+
+			reader, err := store.Get(c.Request.Context(), id, format, storage.ImageOrientation(info.Orientation))
+			if err != nil {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "missing", Error: err.Error()})
+				continue
+			}
+
+			if cfg.MaxArchiveSize > 0 && totalSize+info.Size > cfg.MaxArchiveSize {
+				reader.Close()
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "skipped", Error: "超出归档大小限制"})
+				continue
+			}
+
+			entryName := fmt.Sprintf("%s%s", id, converterExtensionFor(format))
+			w, err := zw.Create(entryName)
+			if err != nil {
+				reader.Close()
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "error", Error: err.Error()})
+				continue
+			}
+
+			written, err := io.Copy(w, reader)
+			reader.Close()
+			if err != nil {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "error", Error: err.Error()})
+				continue
+			}
+
+			totalSize += written
+			manifest = append(manifest, archiveManifestEntry{ID: id, Status: "ok"})
+		}
+
+		manifestData, err := json.MarshalIndent(manifest, "", "  ")
+		if err == nil {
+			if w, err := zw.Create("manifest.json"); err == nil {
+				w.Write(manifestData)
+			}
+		}
+	}
+}
+
+// converterExtensionFor 返回归档条目应使用的文件扩展名
+func converterExtensionFor(format storage.ImageFormat) string {
+	switch format {
+	case storage.WebP:
+		return ".webp"
+	case storage.AVIF:
+		return ".avif"
+	default:
+		return ""
+	}
+}
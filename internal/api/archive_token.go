@@ -0,0 +1,216 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// archiveTokenTTL 归档下载令牌的有效期
+const archiveTokenTTL = 5 * time.Minute
+
+// archiveToken 记录一次批量归档请求的图片ID集合与目标格式
+type archiveToken struct {
+	IDs       []string
+	Format    storage.ImageFormat
+	ExpiresAt time.Time
+}
+
+var (
+	archiveTokensMu sync.Mutex
+	archiveTokens   = make(map[string]archiveToken)
+)
+
+// CreateArchiveTokenRequest 表示创建批量归档下载令牌的请求
+type CreateArchiveTokenRequest struct {
+	IDs    []string `json:"ids"`
+	Format string   `json:"format"` // original/webp/avif，默认 original
+}
+
+// CreateArchiveTokenHandler 创建一个短期有效的归档下载令牌，供 GET /api/archive/:token 使用。
+// 支持 ?tags= 查询参数（逗号分隔），将其展开为所有匹配标签的图片ID并入归档集合。
+func CreateArchiveTokenHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateArchiveTokenRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": "无效的请求体",
+					"error":   err.Error(),
+				})
+				return
+			}
+		}
+
+		format := storage.ImageFormat(req.Format)
+		if format == "" {
+			format = storage.Original
+		}
+
+		ids := req.IDs
+		if tagsParam := c.Query("tags"); tagsParam != "" {
+			wantedTags := strings.Split(tagsParam, ",")
+			images, err := store.List()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "获取图片列表失败",
+					"error":   err.Error(),
+				})
+				return
+			}
+			seen := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				seen[id] = true
+			}
+			for _, img := range images {
+				if !seen[img.ID] && hasAnyTag(img.Tags, wantedTags) {
+					ids = append(ids, img.ID)
+					seen[img.ID] = true
+				}
+			}
+		}
+
+		if len(ids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "未指定任何图片ID",
+			})
+			return
+		}
+
+		token := fmt.Sprintf("%d", time.Now().UnixNano())
+
+		archiveTokensMu.Lock()
+		archiveTokens[token] = archiveToken{
+			IDs:       ids,
+			Format:    format,
+			ExpiresAt: time.Now().Add(archiveTokenTTL),
+		}
+		archiveTokensMu.Unlock()
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "归档令牌创建成功",
+			"data": gin.H{
+				"token":     token,
+				"expiresIn": int(archiveTokenTTL.Seconds()),
+			},
+		})
+	}
+}
+
+// hasAnyTag 判断 tags 中是否包含 wanted 列表中的任意一个标签
+func hasAnyTag(tags, wanted []string) bool {
+	for _, t := range tags {
+		for _, w := range wanted {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ArchiveByTokenHandler 按令牌流式下载此前 CreateArchiveTokenHandler 生成的 ZIP 归档
+func ArchiveByTokenHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+
+		archiveTokensMu.Lock()
+		entry, exists := archiveTokens[token]
+		if exists {
+			delete(archiveTokens, token) // 一次性令牌，下载后立即失效
+		}
+		archiveTokensMu.Unlock()
+
+		if !exists || time.Now().After(entry.ExpiresAt) {
+			c.JSON(http.StatusGone, gin.H{
+				"success": false,
+				"message": "归档令牌不存在或已过期",
+			})
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", "attachment; filename=\"images.zip\"")
+		c.Header("Transfer-Encoding", "chunked")
+
+		zw := zip.NewWriter(c.Writer)
+		defer zw.Close()
+
+		var manifest []archiveManifestEntry
+		var totalSize int64
+
+		for _, id := range entry.IDs {
+			if !isValidImageID(id) {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "invalid", Error: "非法的图片ID"})
+				continue
+			}
+
+			info, err := store.GetInfo(id)
+			if err != nil {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "missing", Error: "图片信息不存在"})
+				continue
+			}
+
+			reader, err := store.Get(c.Request.Context(), id, entry.Format, storage.ImageOrientation(info.Orientation))
+			if err != nil {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "missing", Error: err.Error()})
+				continue
+			}
+
+			if cfg.MaxArchiveSize > 0 && totalSize+info.Size > cfg.MaxArchiveSize {
+				reader.Close()
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "skipped", Error: "超出归档大小限制"})
+				continue
+			}
+
+			entryName := fmt.Sprintf("%s%s", sanitizeArchiveFilename(info.Filename, id), converterExtensionFor(entry.Format))
+			w, err := zw.Create(entryName)
+			if err != nil {
+				reader.Close()
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "error", Error: err.Error()})
+				continue
+			}
+
+			written, err := io.Copy(w, reader)
+			reader.Close()
+			if err != nil {
+				manifest = append(manifest, archiveManifestEntry{ID: id, Status: "error", Error: err.Error()})
+				continue
+			}
+
+			totalSize += written
+			manifest = append(manifest, archiveManifestEntry{ID: id, Status: "ok"})
+		}
+
+		manifestData, err := json.MarshalIndent(manifest, "", "  ")
+		if err == nil {
+			if w, err := zw.Create("manifest.json"); err == nil {
+				w.Write(manifestData)
+			}
+		}
+	}
+}
+
+// sanitizeArchiveFilename 去除文件名中的路径分隔符，避免 ZIP 条目逃逸目标目录
+func sanitizeArchiveFilename(filename, fallbackID string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(filename)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if name == "" {
+		return fallbackID
+	}
+	return name
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/emper0r/InfiniteImages/pkg/converter"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUploadSessionRequest 表示创建断点续传会话的请求
+type CreateUploadSessionRequest struct {
+	Filename  string `json:"filename" binding:"required"`
+	TotalSize int64  `json:"totalSize" binding:"required"`
+	ChunkSize int64  `json:"chunkSize" binding:"required"`
+}
+
+// CreateUploadSessionHandler 创建一个断点续传会话
+func CreateUploadSessionHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateUploadSessionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求体",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if req.TotalSize > cfg.MaxUploadSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("文件大小超过限制（最大 %d 字节）", cfg.MaxUploadSize),
+			})
+			return
+		}
+
+		sid, err := store.CreateUploadSession(req.Filename, req.TotalSize, req.ChunkSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法创建上传会话",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "上传会话创建成功",
+			"data": gin.H{
+				"sessionId": sid,
+			},
+		})
+	}
+}
+
+// UploadChunkHandler 写入一个数据块，偏移量通过查询参数 ?offset= 指定，
+// 分块数据本身作为请求体原始字节传输
+func UploadChunkHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.Param("sid")
+
+		offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的 offset 参数",
+			})
+			return
+		}
+
+		writer, err := store.OpenChunk(sid, offset)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无法打开数据块写入",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		written, err := io.Copy(writer, c.Request.Body)
+		closeErr := writer.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "写入数据块失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if closeErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "保存数据块状态失败",
+				"error":   closeErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "数据块写入成功",
+			"data": gin.H{
+				"offset":  offset,
+				"written": written,
+			},
+		})
+	}
+}
+
+// CompleteUploadSessionHandler 校验会话完整性，落地临时文件，并执行与 UploadHandler 相同的
+// 解码/转换/存储流水线
+func CompleteUploadSessionHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	// cfg.validate() 已确保该正则可编译，这里直接信任配置
+	allowedTypePattern := regexp.MustCompile(cfg.AllowedImageTypePattern)
+
+	return func(c *gin.Context) {
+		sid := c.Param("sid")
+
+		baseInfo, err := store.FinalizeChunked(sid)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "上传会话尚未完成或不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		// FinalizeChunked 尚不知道图片的真实朝向，先统一落在 landscape 目录下
+		original, err := store.Get(c.Request.Context(), baseInfo.ID, storage.Original, storage.Landscape)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法读取已落地的原始图片",
+				"error":   err.Error(),
+			})
+			return
+		}
+		raw, err := io.ReadAll(original)
+		original.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法读取原始图片数据",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		// FinalizeChunked 已基于魔数做过一次宽松的"是否为图片"校验，这里再按配置的
+		// 允许类型白名单做一次精确校验；任意一步失败都必须删除已公开落地的文件，
+		// 否则校验形同虚设（与 v1 上传路径的 chunk2-4 校验保持同等强度）
+		sniffLen := len(raw)
+		if sniffLen > 512 {
+			sniffLen = 512
+		}
+		mimeType := http.DetectContentType(raw[:sniffLen])
+		if !allowedTypePattern.MatchString(mimeType) {
+			_ = store.Delete(c.Request.Context(), baseInfo.ID, storage.Original, storage.Landscape)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("文件的实际内容类型 %s 不在允许范围内", mimeType),
+			})
+			return
+		}
+
+		options := converter.DefaultOptions()
+		options.Quality = cfg.ImageQuality
+		options.CompressionLevel = cfg.CompressionEffort
+		options.Lossless = cfg.ForceLossless
+		options.Thumbnails = []int{128, 256, 512, 1024}
+
+		data, thumbnails, info, err := converter.ConvertFromReader(bytes.NewReader(raw), options)
+		if err != nil {
+			_ = store.Delete(c.Request.Context(), baseInfo.ID, storage.Original, storage.Landscape)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法转换图片",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		orientation := storage.ImageOrientation(info.Orientation)
+		if orientation != storage.Landscape {
+			// 真实朝向为纵向，需要把原始图片从占位目录迁移到正确的朝向目录
+			if err := store.Delete(c.Request.Context(), baseInfo.ID, storage.Original, storage.Landscape); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "无法迁移原始图片朝向",
+					"error":   err.Error(),
+				})
+				return
+			}
+			if err := store.SaveVariant(c.Request.Context(), baseInfo.ID, bytes.NewReader(raw), baseInfo.Filename, storage.Original, orientation, storage.OriginalSize); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "无法保存迁移后的原始图片",
+					"error":   err.Error(),
+				})
+				return
+			}
+		}
+
+		webpReader := strings.NewReader(string(data))
+		if err := store.SaveVariant(c.Request.Context(), baseInfo.ID, webpReader, baseInfo.Filename, storage.WebP, orientation, storage.OriginalSize); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法保存 WebP 图片",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		var savedThumbnails []int
+		for width, thumbData := range thumbnails {
+			thumbReader := strings.NewReader(string(thumbData))
+			if err := store.SaveVariant(c.Request.Context(), baseInfo.ID, thumbReader, baseInfo.Filename, storage.WebP, orientation, width); err != nil {
+				continue
+			}
+			savedThumbnails = append(savedThumbnails, width)
+		}
+
+		imageInfo := &storage.ImageInfo{
+			ID:          baseInfo.ID,
+			Filename:    baseInfo.Filename,
+			StoragePath: "original/" + string(orientation),
+			Size:        baseInfo.Size,
+			Width:       info.Width,
+			Height:      info.Height,
+			Format:      string(info.Format),
+			Orientation: info.Orientation,
+			Tags:        []string{},
+			CreatedAt:   time.Now(),
+			Thumbnails:  savedThumbnails,
+			Frames:      info.Frames,
+			DurationMs:  info.DurationMs,
+			Formats:     []string{string(storage.WebP)},
+		}
+
+		if err := store.SaveInfo(imageInfo); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法保存图片信息",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		url := store.GetURL(baseInfo.ID, storage.Original, orientation, storage.OriginalSize)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "上传完成",
+			"data": gin.H{
+				"id":  baseInfo.ID,
+				"url": url,
+			},
+		})
+	}
+}
+
+// sessionOffsetProvider 是能够报告断点续传会话当前偏移量的存储驱动实现的可选接口
+// （目前仅本地存储实现了该方法；GridFS/OSS/S3 驱动未实现，HEAD 查询返回 501）
+type sessionOffsetProvider interface {
+	SessionOffset(sessionID string) (offset int64, totalSize int64, err error)
+}
+
+// UploadSessionStatusHandler 以 tus.io 风格的 HEAD 请求查询会话当前偏移量，
+// 通过 Upload-Offset/Upload-Length 响应头而非 JSON 响应体传递结果
+func UploadSessionStatusHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.Param("sid")
+
+		provider, ok := store.(sessionOffsetProvider)
+		if !ok {
+			c.Status(http.StatusNotImplemented)
+			return
+		}
+
+		offset, totalSize, err := provider.SessionOffset(sid)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+		c.Header("Upload-Length", strconv.FormatInt(totalSize, 10))
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// CancelUploadSessionHandler 取消一个未完成的断点续传会话
+func CancelUploadSessionHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid := c.Param("sid")
+
+		if err := store.CancelUploadSession(sid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法取消上传会话",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "上传会话已取消",
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/emper0r/InfiniteImages/pkg/converter"
+	"github.com/gin-gonic/gin"
+)
+
+// CropRequest 表示裁剪请求
+type CropRequest struct {
+	X       int  `json:"x"`
+	Y       int  `json:"y"`
+	Width   int  `json:"width"`
+	Height  int  `json:"height"`
+	AsNewID bool `json:"asNewId"` // true 则另存为新图片，否则覆盖原图的派生格式变体
+}
+
+// CropHandler 处理对已存储图片的裁剪请求
+func CropHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "缺少图片ID",
+			})
+			return
+		}
+
+		var req CropRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求体",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		info, err := store.GetInfo(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "图片不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if req.Width <= 0 || req.Height <= 0 ||
+			req.X < 0 || req.Y < 0 ||
+			req.X+req.Width > info.Width || req.Y+req.Height > info.Height {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("裁剪区域超出图片范围（原图尺寸 %dx%d）", info.Width, info.Height),
+			})
+			return
+		}
+
+		orientation := storage.ImageOrientation(info.Orientation)
+
+		original, err := store.Get(c.Request.Context(), id, storage.Original, orientation)
+		if err != nil {
+			if handleArchivedError(c, err) {
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法读取原始图片",
+				"error":   err.Error(),
+			})
+			return
+		}
+		defer original.Close()
+
+		options := converter.DefaultOptions()
+		options.Quality = cfg.ImageQuality
+		options.CompressionLevel = cfg.CompressionEffort
+		options.Lossless = cfg.ForceLossless
+		options.CropX = req.X
+		options.CropY = req.Y
+		options.CropW = req.Width
+		options.CropH = req.Height
+
+		data, _, croppedInfo, err := converter.ConvertFromReader(original, options)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "裁剪失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		croppedOrientation := storage.ImageOrientation(croppedInfo.Orientation)
+
+		targetID := id
+		if req.AsNewID {
+			reader := strings.NewReader(string(data))
+			newID, err := store.Save(c.Request.Context(), reader, info.Filename, storage.WebP, croppedOrientation)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "无法保存裁剪结果",
+					"error":   err.Error(),
+				})
+				return
+			}
+			targetID = newID
+
+			newInfo := &storage.ImageInfo{
+				ID:          newID,
+				Filename:    info.Filename,
+				StoragePath: "webp/" + string(croppedOrientation),
+				Size:        int64(len(data)),
+				Width:       req.Width,
+				Height:      req.Height,
+				Format:      string(storage.WebP),
+				Orientation: string(croppedOrientation),
+				Tags:        info.Tags,
+				CreatedAt:   info.CreatedAt,
+			}
+			if err := store.SaveInfo(newInfo); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "无法保存裁剪图片信息",
+					"error":   err.Error(),
+				})
+				return
+			}
+		} else {
+			reader := strings.NewReader(string(data))
+			if err := store.SaveVariant(c.Request.Context(), id, reader, info.Filename, storage.WebP, croppedOrientation, storage.OriginalSize); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "无法保存裁剪结果",
+					"error":   err.Error(),
+				})
+				return
+			}
+			info.Width = req.Width
+			info.Height = req.Height
+			if err := store.SaveInfo(info); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "无法更新图片信息",
+					"error":   err.Error(),
+				})
+				return
+			}
+		}
+
+		url := store.GetURL(targetID, storage.WebP, croppedOrientation, storage.OriginalSize)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "裁剪成功",
+			"data": gin.H{
+				"id":  targetID,
+				"url": url,
+			},
+		})
+	}
+}
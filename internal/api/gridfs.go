@@ -0,0 +1,71 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// GridFSStreamHandler 将 GridFS（或其他支持 Get 的后端）中的图片流式转发给客户端，
+// 对应 GridFSStorage.GetURL 返回的路由 /api/images/{id}/raw?format=xxx（该地址不带签名）
+func GridFSStreamHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "缺少图片ID",
+			})
+			return
+		}
+
+		format := storage.ImageFormat(c.DefaultQuery("format", string(storage.Original)))
+
+		info, err := store.GetInfo(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "图片不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		reader, err := store.Get(c.Request.Context(), id, format, storage.ImageOrientation(info.Orientation))
+		if err != nil {
+			if handleArchivedError(c, err) {
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "无法读取图片",
+				"error":   err.Error(),
+			})
+			return
+		}
+		defer reader.Close()
+
+		if info.SHA256 != "" {
+			c.Header("ETag", "\""+info.SHA256+"\"")
+		}
+		c.Header("Content-Type", contentTypeForFormat(format))
+		if _, err := io.Copy(c.Writer, reader); err != nil {
+			c.Status(http.StatusInternalServerError)
+		}
+	}
+}
+
+// contentTypeForFormat 返回给定图片格式对应的 Content-Type
+func contentTypeForFormat(format storage.ImageFormat) string {
+	switch format {
+	case storage.WebP:
+		return "image/webp"
+	case storage.AVIF:
+		return "image/avif"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -3,28 +3,70 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/events"
 	"github.com/emper0r/InfiniteImages/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
+// refCountMu 序列化内容去重图片的引用计数读-改-写（GetInfo/LookupByHash -> 调整 RefCount
+// -> SaveInfo）。Storage 接口本身不保证这段序列的原子性，并发的去重命中上传与删除请求
+// 可能交错执行，导致计数丢失更新甚至仍有引用的文件被提前物理删除。上传路径
+// （internal/api/upload.go 的去重命中分支）复用同一把锁。
+var refCountMu sync.Mutex
+
 // ImageResponse 表示单个图片的响应
 type ImageResponse struct {
-	ID           string    `json:"id"`
-	Filename     string    `json:"filename"`
-	URL          string    `json:"url"`
-	ThumbnailURL string    `json:"thumbnailUrl"`
-	Size         int64     `json:"size"`
-	Width        int       `json:"width"`
-	Height       int       `json:"height"`
-	Format       string    `json:"format"`
-	Orientation  string    `json:"orientation"`
-	Tags         []string  `json:"tags"`
-	CreatedAt    time.Time `json:"createdAt"`
-	ExpiresAt    time.Time `json:"expiresAt,omitempty"`
-	HasExpiry    bool      `json:"hasExpiry"`
+	ID           string         `json:"id"`
+	Filename     string         `json:"filename"`
+	URL          string         `json:"url"`
+	ThumbnailURL string         `json:"thumbnailUrl"`
+	Thumbnails   map[int]string `json:"thumbnails,omitempty"`
+	Size         int64          `json:"size"`
+	Width        int            `json:"width"`
+	Height       int            `json:"height"`
+	Format       string         `json:"format"`
+	Orientation  string         `json:"orientation"`
+	Tags         []string       `json:"tags"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	ExpiresAt    time.Time      `json:"expiresAt,omitempty"`
+	HasExpiry    bool           `json:"hasExpiry"`
+	Frames       int            `json:"frames"`
+	DurationMs   int            `json:"durationMs,omitempty"`
+	SHA256       string         `json:"sha256,omitempty"`
+}
+
+// thumbnailURLFor 返回图片最适合作为默认缩略图展示的 URL：
+// 优先使用已生成的最小缩略图变体，否则退回到完整尺寸的 WebP。
+func thumbnailURLFor(store storage.Storage, img storage.ImageInfo) string {
+	orientation := storage.ImageOrientation(img.Orientation)
+	if len(img.Thumbnails) == 0 {
+		return store.GetURL(img.ID, storage.WebP, orientation, storage.OriginalSize)
+	}
+
+	smallest := img.Thumbnails[0]
+	for _, width := range img.Thumbnails {
+		if width < smallest {
+			smallest = width
+		}
+	}
+	return store.GetURL(img.ID, storage.WebP, orientation, smallest)
+}
+
+// thumbnailURLSet 返回图片所有已生成缩略图宽度到 URL 的映射
+func thumbnailURLSet(store storage.Storage, img storage.ImageInfo) map[int]string {
+	if len(img.Thumbnails) == 0 {
+		return nil
+	}
+	orientation := storage.ImageOrientation(img.Orientation)
+	urls := make(map[int]string, len(img.Thumbnails))
+	for _, width := range img.Thumbnails {
+		urls[width] = store.GetURL(img.ID, storage.WebP, orientation, width)
+	}
+	return urls
 }
 
 // ListImagesResponse 表示图片列表响应
@@ -108,14 +150,15 @@ func ListImagesHandler(cfg *config.Config, store storage.Storage) gin.HandlerFun
 		var responseData []ImageResponse
 		for _, img := range pageImages {
 			// 获取图片URL
-			url := store.GetURL(img.ID, storage.Original, storage.ImageOrientation(img.Orientation))
-			thumbnailURL := store.GetURL(img.ID, storage.WebP, storage.ImageOrientation(img.Orientation))
+			url := store.GetURL(img.ID, storage.Original, storage.ImageOrientation(img.Orientation), storage.OriginalSize)
+			thumbnailURL := thumbnailURLFor(store, img)
 
 			responseData = append(responseData, ImageResponse{
 				ID:           img.ID,
 				Filename:     img.Filename,
 				URL:          url,
 				ThumbnailURL: thumbnailURL,
+				Thumbnails:   thumbnailURLSet(store, img),
 				Size:         img.Size,
 				Width:        img.Width,
 				Height:       img.Height,
@@ -125,6 +168,9 @@ func ListImagesHandler(cfg *config.Config, store storage.Storage) gin.HandlerFun
 				CreatedAt:    img.CreatedAt,
 				ExpiresAt:    img.ExpiresAt,
 				HasExpiry:    img.HasExpiry,
+				Frames:       img.Frames,
+				DurationMs:   img.DurationMs,
+				SHA256:       img.SHA256,
 			})
 		}
 
@@ -164,8 +210,12 @@ func GetImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc
 		}
 
 		// 获取图片URL
-		url := store.GetURL(img.ID, storage.Original, storage.ImageOrientation(img.Orientation))
-		thumbnailURL := store.GetURL(img.ID, storage.WebP, storage.ImageOrientation(img.Orientation))
+		url := store.GetURL(img.ID, storage.Original, storage.ImageOrientation(img.Orientation), storage.OriginalSize)
+		thumbnailURL := thumbnailURLFor(store, *img)
+
+		if img.SHA256 != "" {
+			c.Header("ETag", "\""+img.SHA256+"\"")
+		}
 
 		// 构建响应
 		c.JSON(http.StatusOK, gin.H{
@@ -176,6 +226,7 @@ func GetImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc
 				Filename:     img.Filename,
 				URL:          url,
 				ThumbnailURL: thumbnailURL,
+				Thumbnails:   thumbnailURLSet(store, *img),
 				Size:         img.Size,
 				Width:        img.Width,
 				Height:       img.Height,
@@ -185,13 +236,16 @@ func GetImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc
 				CreatedAt:    img.CreatedAt,
 				ExpiresAt:    img.ExpiresAt,
 				HasExpiry:    img.HasExpiry,
+				Frames:       img.Frames,
+				DurationMs:   img.DurationMs,
+				SHA256:       img.SHA256,
 			},
 		})
 	}
 }
 
 // DeleteImageHandler 处理删除图片请求
-func DeleteImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+func DeleteImageHandler(cfg *config.Config, store storage.Storage, bus events.EventBus) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取图片ID
 		id := c.Param("id")
@@ -203,6 +257,11 @@ func DeleteImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFu
 			return
 		}
 
+		// 锁住整个引用计数读-改-写序列（含 RefCount==1 时的物理删除），避免与并发的
+		// 去重命中上传（internal/api/upload.go）交错执行导致计数错乱或文件被提前删除
+		refCountMu.Lock()
+		defer refCountMu.Unlock()
+
 		// 获取图片信息
 		img, err := store.GetInfo(id)
 		if err != nil {
@@ -213,9 +272,37 @@ func DeleteImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFu
 			return
 		}
 
+		// 内容去重的图片可能被多次上传命中，引用计数大于 1 时只递减计数，
+		// 物理文件留给最后一个引用者删除
+		if img.RefCount > 1 {
+			img.RefCount--
+			if err := store.SaveInfo(img); err != nil {
+				c.JSON(http.StatusInternalServerError, DeleteImageResponse{
+					Success: false,
+					Message: "更新引用计数失败: " + err.Error(),
+				})
+				return
+			}
+
+			bus.Publish(c.Request.Context(), string(events.ImageDeleted), events.Event{
+				Type:      events.ImageDeleted,
+				Sequence:  events.NextSequence(),
+				Timestamp: time.Now(),
+				ActorIP:   c.ClientIP(),
+				Image:     img,
+			})
+
+			c.JSON(http.StatusOK, DeleteImageResponse{
+				Success: true,
+				Message: "删除图片成功（仍有其他引用，未物理删除）",
+				ID:      id,
+			})
+			return
+		}
+
 		// 删除所有格式的图片
 		orientation := storage.ImageOrientation(img.Orientation)
-		if err := store.Delete(id, storage.Original, orientation); err != nil {
+		if err := store.Delete(c.Request.Context(), id, storage.Original, orientation); err != nil {
 			c.JSON(http.StatusInternalServerError, DeleteImageResponse{
 				Success: false,
 				Message: "删除原始图片失败: " + err.Error(),
@@ -223,11 +310,14 @@ func DeleteImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFu
 			return
 		}
 
-		// 尝试删除 WebP 格式（如果存在）
-		_ = store.Delete(id, storage.WebP, orientation)
-
-		// 尝试删除 AVIF 格式（如果存在）
-		_ = store.Delete(id, storage.AVIF, orientation)
+		// 删除 Original 之外实际保存过的派生格式及其缩略图变体，避免遗漏 JXL 等后续
+		// 新增格式或自定义 formats 组合产生的孤儿文件
+		for _, storageFormat := range img.VariantFormats() {
+			_ = store.DeleteVariant(c.Request.Context(), id, storageFormat, orientation, storage.OriginalSize)
+			for _, width := range img.Thumbnails {
+				_ = store.DeleteVariant(c.Request.Context(), id, storageFormat, orientation, width)
+			}
+		}
 
 		// 删除图片信息
 		if err := store.DeleteInfo(id); err != nil {
@@ -238,6 +328,14 @@ func DeleteImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFu
 			return
 		}
 
+		bus.Publish(c.Request.Context(), string(events.ImageDeleted), events.Event{
+			Type:      events.ImageDeleted,
+			Sequence:  events.NextSequence(),
+			Timestamp: time.Now(),
+			ActorIP:   c.ClientIP(),
+			Image:     img,
+		})
+
 		c.JSON(http.StatusOK, DeleteImageResponse{
 			Success: true,
 			Message: "删除图片成功",
@@ -247,7 +345,7 @@ func DeleteImageHandler(cfg *config.Config, store storage.Storage) gin.HandlerFu
 }
 
 // UpdateTagsHandler 处理更新图片标签请求
-func UpdateTagsHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+func UpdateTagsHandler(cfg *config.Config, store storage.Storage, bus events.EventBus) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取图片ID
 		id := c.Param("id")
@@ -296,6 +394,14 @@ func UpdateTagsHandler(cfg *config.Config, store storage.Storage) gin.HandlerFun
 			return
 		}
 
+		bus.Publish(c.Request.Context(), string(events.ImageTagsUpdated), events.Event{
+			Type:      events.ImageTagsUpdated,
+			Sequence:  events.NextSequence(),
+			Timestamp: time.Now(),
+			ActorIP:   c.ClientIP(),
+			Image:     img,
+		})
+
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "更新标签成功",
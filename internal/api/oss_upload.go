@@ -0,0 +1,300 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/emper0r/InfiniteImages/pkg/converter"
+	"github.com/gin-gonic/gin"
+)
+
+// ossPolicyDoc 描述 OSS PostObject 签名策略文档（过期时间与约束条件）
+type ossPolicyDoc struct {
+	Expiration string          `json:"expiration"`
+	Conditions [][]interface{} `json:"conditions"`
+}
+
+// ossCallbackParam 是 callback 字段解码后的 JSON 结构，随表单一并提交给 OSS
+type ossCallbackParam struct {
+	CallbackURL      string `json:"callbackUrl"`
+	CallbackBody     string `json:"callbackBody"`
+	CallbackBodyType string `json:"callbackBodyType"`
+}
+
+// OSSUploadPolicyHandler 返回一份签名过的直传策略，供浏览器直接 PUT/POST 到 OSS，
+// 服务端不再经手文件字节
+func OSSUploadPolicyHandler(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.StorageType != "oss" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "当前存储类型不是 oss，无法签发直传策略",
+			})
+			return
+		}
+
+		expiration := time.Now().Add(15 * time.Minute).UTC().Format("2006-01-02T15:04:05.000Z")
+		prefix := cfg.OSSUploadPrefix
+
+		policy := ossPolicyDoc{
+			Expiration: expiration,
+			Conditions: [][]interface{}{
+				{"content-length-range", 0, cfg.MaxUploadSize},
+				{"starts-with", "$key", prefix},
+			},
+		}
+
+		policyJSON, err := json.Marshal(policy)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法构建上传策略",
+				"error":   err.Error(),
+			})
+			return
+		}
+		encodedPolicy := base64.StdEncoding.EncodeToString(policyJSON)
+
+		mac := hmac.New(sha1.New, []byte(cfg.OSSAccessKeySecret))
+		mac.Write([]byte(encodedPolicy))
+		signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		callback := ossCallbackParam{
+			CallbackURL:      cfg.OSSCallbackURL,
+			CallbackBody:     "filename=${object}&size=${size}&mimeType=${mimeType}&width=${imageInfo.width}&height=${imageInfo.height}",
+			CallbackBodyType: "application/x-www-form-urlencoded",
+		}
+		callbackJSON, err := json.Marshal(callback)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法构建回调参数",
+				"error":   err.Error(),
+			})
+			return
+		}
+		encodedCallback := base64.StdEncoding.EncodeToString(callbackJSON)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "上传策略签发成功",
+			"data": gin.H{
+				"accessid":  cfg.OSSAccessKeyID,
+				"host":      fmt.Sprintf("https://%s.%s", cfg.OSSBucket, strings.TrimPrefix(cfg.OSSEndpoint, "https://")),
+				"policy":    encodedPolicy,
+				"signature": signature,
+				"dir":       prefix,
+				"expire":    expiration,
+				"callback":  encodedCallback,
+			},
+		})
+	}
+}
+
+// OSSUploadCallbackHandler 校验阿里云 OSS 的服务端回调签名（RSA-SHA1 over path+"\n"+body），
+// 验证通过后下载刚写入的对象、跑一遍与 UploadHandler 相同的转换流水线，并持久化 ImageInfo
+func OSSUploadCallbackHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无法读取回调请求体",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := verifyOSSCallbackSignature(c, body); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "回调签名校验失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无法解析回调表单",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		objectKey := values.Get("filename")
+		if objectKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "回调表单缺少 filename",
+			})
+			return
+		}
+
+		// 直传对象已经落在 OSS 上；下载回来跑解码/缩略图流水线，再复用同一个 id 写回各个变体
+		id, filename, err := processOSSCallbackObject(c.Request.Context(), cfg, store, objectKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "处理直传对象失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"filename": filename,
+			"data": gin.H{
+				"id": id,
+			},
+		})
+	}
+}
+
+// verifyOSSCallbackSignature 按阿里云 OSS 回调签名规范验证 Authorization 头：
+// 拉取 x-oss-pub-key-url 指向的公钥，验证其对 "path\nbody" 的 RSA-SHA1 签名
+func verifyOSSCallbackSignature(c *gin.Context, body []byte) error {
+	authHeader := c.GetHeader("Authorization")
+	pubKeyURLHeader := c.GetHeader("x-oss-pub-key-url")
+	if authHeader == "" || pubKeyURLHeader == "" {
+		return fmt.Errorf("缺少 Authorization 或 x-oss-pub-key-url 头")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(authHeader)
+	if err != nil {
+		return fmt.Errorf("无法解码签名: %w", err)
+	}
+
+	pubKeyURLBytes, err := base64.StdEncoding.DecodeString(pubKeyURLHeader)
+	if err != nil {
+		return fmt.Errorf("无法解码公钥地址: %w", err)
+	}
+	pubKeyURL := string(pubKeyURLBytes)
+	if !strings.HasPrefix(pubKeyURL, "https://gosspublic.alicdn.com/") && !strings.HasPrefix(pubKeyURL, "https://gosspublic-internal.alicdn.com/") {
+		return fmt.Errorf("公钥地址不在阿里云官方域名范围内: %s", pubKeyURL)
+	}
+
+	resp, err := http.Get(pubKeyURL)
+	if err != nil {
+		return fmt.Errorf("无法获取回调公钥: %w", err)
+	}
+	defer resp.Body.Close()
+
+	pubKeyPEM, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("无法读取回调公钥: %w", err)
+	}
+
+	block, _ := pem.Decode(pubKeyPEM)
+	if block == nil {
+		return fmt.Errorf("无法解析公钥 PEM")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("无法解析公钥: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("公钥类型不是 RSA")
+	}
+
+	path := c.Request.URL.Path
+	if c.Request.URL.RawQuery != "" {
+		path += "?" + c.Request.URL.RawQuery
+	}
+	signedContent := path + "\n" + string(body)
+
+	digest := sha1.Sum([]byte(signedContent))
+	if err := rsa.VerifyPKCS1v15(rsaPub, crypto.SHA1, digest[:], signature); err != nil {
+		return fmt.Errorf("签名验证不通过: %w", err)
+	}
+
+	return nil
+}
+
+// processOSSCallbackObject 下载刚直传到 OSS 的对象，跑一遍转换流水线，
+// 并按 UploadHandler 的方式保存各个派生变体与元数据
+func processOSSCallbackObject(ctx context.Context, cfg *config.Config, store storage.Storage, objectKey string) (id string, filename string, err error) {
+	filename = objectKey[strings.LastIndex(objectKey, "/")+1:]
+
+	ossStore, ok := store.(*storage.OSSStorage)
+	if !ok {
+		return "", "", fmt.Errorf("当前存储驱动不是 oss")
+	}
+
+	raw, err := ossStore.GetObjectBytes(objectKey)
+	if err != nil {
+		return "", "", fmt.Errorf("无法下载直传对象: %w", err)
+	}
+
+	options := converter.DefaultOptions()
+	options.Quality = cfg.ImageQuality
+	options.CompressionLevel = cfg.CompressionEffort
+	options.Lossless = cfg.ForceLossless
+	options.Thumbnails = []int{128, 256, 512, 1024}
+
+	data, thumbnails, info, err := converter.ConvertFromReader(bytes.NewReader(raw), options)
+	if err != nil {
+		return "", "", fmt.Errorf("无法转换图片: %w", err)
+	}
+
+	orientation := storage.ImageOrientation(info.Orientation)
+
+	newID, err := store.Save(ctx, bytes.NewReader(raw), filename, storage.Original, orientation)
+	if err != nil {
+		return "", "", fmt.Errorf("无法保存原始图片: %w", err)
+	}
+
+	if err := store.SaveVariant(ctx, newID, bytes.NewReader(data), filename, storage.WebP, orientation, storage.OriginalSize); err != nil {
+		return "", "", fmt.Errorf("无法保存 WebP 图片: %w", err)
+	}
+
+	var savedThumbnails []int
+	for width, thumbData := range thumbnails {
+		if err := store.SaveVariant(ctx, newID, bytes.NewReader(thumbData), filename, storage.WebP, orientation, width); err != nil {
+			continue
+		}
+		savedThumbnails = append(savedThumbnails, width)
+	}
+
+	imageInfo := &storage.ImageInfo{
+		ID:          newID,
+		Filename:    filename,
+		StoragePath: "original/" + string(orientation),
+		Size:        int64(len(raw)),
+		Width:       info.Width,
+		Height:      info.Height,
+		Format:      string(info.Format),
+		Orientation: info.Orientation,
+		Tags:        []string{},
+		CreatedAt:   time.Now(),
+		Thumbnails:  savedThumbnails,
+		Frames:      info.Frames,
+		DurationMs:  info.DurationMs,
+	}
+
+	if err := store.SaveInfo(imageInfo); err != nil {
+		return "", "", fmt.Errorf("无法保存图片信息: %w", err)
+	}
+
+	return newID, filename, nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// SetStorageClassRequest 表示调整图片存储层级的请求
+type SetStorageClassRequest struct {
+	StorageClass string `json:"storageClass" binding:"required"`
+}
+
+// SetStorageClassHandler 调整图片的存储层级
+func SetStorageClassHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req SetStorageClassRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求体",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		class := storage.StorageClass(req.StorageClass)
+		switch class {
+		case storage.StorageClassStandard, storage.StorageClassInfrequent, storage.StorageClassArchive, storage.StorageClassDeepArchive:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的存储层级",
+			})
+			return
+		}
+
+		if err := store.SetStorageClass(id, class); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "无法调整存储层级",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "存储层级调整成功",
+			"data": gin.H{
+				"id":           id,
+				"storageClass": string(class),
+			},
+		})
+	}
+}
+
+// RestoreRequest 表示取回冷层级图片的请求
+type RestoreRequest struct {
+	Days int `json:"days"`
+}
+
+// RestoreHandler 对冷层级图片发起取回
+func RestoreHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req RestoreRequest
+		_ = c.ShouldBindJSON(&req)
+
+		if err := store.Restore(id, req.Days); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "取回失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "取回请求已受理",
+		})
+	}
+}
+
+// handleArchivedError 在图片处于冷层级且不可读时写入 409 响应，返回是否已处理该请求
+func handleArchivedError(c *gin.Context, err error) bool {
+	var archived *storage.ErrObjectArchived
+	if !errors.As(err, &archived) {
+		return false
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"success":       false,
+		"message":       "图片已归档，请先取回",
+		"restoreStatus": archived.RestoreStatus,
+	})
+	return true
+}
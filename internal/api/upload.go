@@ -1,15 +1,20 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/events"
 	"github.com/emper0r/InfiniteImages/internal/storage"
 	"github.com/emper0r/InfiniteImages/pkg/converter"
 	"github.com/gin-gonic/gin"
@@ -17,15 +22,67 @@ import (
 
 // UploadResponse 表示上传响应
 type UploadResponse struct {
-	Success bool     `json:"success"`
-	Message string   `json:"message"`
-	Data    []string `json:"data,omitempty"`
-	Errors  []string `json:"errors,omitempty"`
+	Success bool                `json:"success"`
+	Message string              `json:"message"`
+	Data    []map[string]string `json:"data,omitempty"`
+	Errors  []string            `json:"errors,omitempty"`
 }
 
-// UploadHandler 处理图片上传
-func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
+// defaultUploadFormats 未指定 formats 表单字段时使用的目标格式，保持与历史行为一致
+var defaultUploadFormats = []converter.ImageFormat{converter.WebP}
+
+// parseFormats 解析 formats 表单字段（逗号分隔，例如 "webp,avif,jxl"），
+// 过滤掉无法识别的格式名；为空或全部无法识别时退回 defaultUploadFormats
+func parseFormats(csv string) []converter.ImageFormat {
+	if csv == "" {
+		return defaultUploadFormats
+	}
+
+	known := map[string]converter.ImageFormat{
+		"webp": converter.WebP,
+		"avif": converter.AVIF,
+		"jxl":  converter.JXL,
+		"jpeg": converter.JPEG,
+		"jpg":  converter.JPEG,
+		"png":  converter.PNG,
+		"gif":  converter.GIF,
+	}
+
+	var formats []converter.ImageFormat
+	for _, name := range strings.Split(csv, ",") {
+		if format, ok := known[strings.ToLower(strings.TrimSpace(name))]; ok {
+			formats = append(formats, format)
+		}
+	}
+
+	if len(formats) == 0 {
+		return defaultUploadFormats
+	}
+	return formats
+}
+
+// UploadHandler 处理图片上传，通过 backend 表单字段（local/s3/oss，留空时使用默认后端）
+// 在 registry 中解析出本次请求实际写入的存储实例。formats 表单字段（逗号分隔）指定需要
+// 生成的目标格式，留空时仅生成 WebP，与历史行为保持一致；quality/lossless/effort 可覆盖
+// 对应的默认编码参数。
+//
+// 注意：internal/api/images.go 的缩略图 URL 拼接假定每张图片都存在 WebP 变体，
+// 若调用方传入不含 webp 的 formats（例如仅 "avif,jxl"），列表/详情接口的响应式
+// srcset 将无法找到对应的缩略图；这一限制目前未在 images.go 中处理，留待后续请求解决。
+func UploadHandler(cfg *config.Config, bus events.EventBus, registry *storage.Registry) gin.HandlerFunc {
+	// cfg.validate() 已确保该正则可编译，这里直接信任配置
+	allowedTypePattern := regexp.MustCompile(cfg.AllowedImageTypePattern)
+
 	return func(c *gin.Context) {
+		store, err := registry.Resolve(c.PostForm("backend"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, UploadResponse{
+				Success: false,
+				Message: "无效的存储后端: " + err.Error(),
+			})
+			return
+		}
+
 		// 检查是否是多文件上传
 		form, err := c.MultipartForm()
 		if err != nil {
@@ -56,9 +113,12 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 			return
 		}
 
+		formats := parseFormats(c.PostForm("formats"))
+
 		// 处理每个文件
-		var urls []string
+		var results []map[string]string
 		var errors []string
+		ctx := c.Request.Context()
 
 		for _, file := range files {
 			// 检查文件大小
@@ -67,12 +127,7 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 				continue
 			}
 
-			// 检查文件类型
 			ext := strings.ToLower(filepath.Ext(file.Filename))
-			if !isAllowedImageType(ext) {
-				errors = append(errors, fmt.Sprintf("文件 %s 类型不支持", file.Filename))
-				continue
-			}
 
 			// 打开文件
 			src, err := file.Open()
@@ -97,6 +152,72 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 				continue
 			}
 
+			// 基于魔数嗅探真实内容类型，而非信任客户端文件名后缀（防御 evil.php.jpg 一类伪装）
+			if _, err = tmpFile.Seek(0, 0); err != nil {
+				errors = append(errors, fmt.Sprintf("无法重置文件指针: %v", err))
+				continue
+			}
+			sniffBuf := make([]byte, 512)
+			n, err := tmpFile.Read(sniffBuf)
+			if err != nil && err != io.EOF {
+				errors = append(errors, fmt.Sprintf("无法读取文件内容用于类型嗅探: %v", err))
+				continue
+			}
+			mimeType := http.DetectContentType(sniffBuf[:n])
+			if !allowedTypePattern.MatchString(mimeType) {
+				errors = append(errors, fmt.Sprintf("文件 %s 的实际内容类型 %s 不在允许范围内", file.Filename, mimeType))
+				continue
+			}
+
+			// 嗅探出的类型与文件名后缀不一致时，以真实类型重写存储用的文件名，
+			// 避免例如把 PNG 内容当作 .jpg 存储误导下游按扩展名判断格式
+			filename := file.Filename
+			if realExt, ok := extensionForMIME(mimeType); ok && !strings.EqualFold(ext, realExt) {
+				filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + realExt
+			}
+
+			// 计算内容哈希用于内容寻址去重，命中时直接复用已有图片，跳过转换与二次写入
+			if _, err = tmpFile.Seek(0, 0); err != nil {
+				errors = append(errors, fmt.Sprintf("无法重置文件指针: %v", err))
+				continue
+			}
+			hasher := sha256.New()
+			if _, err = io.Copy(hasher, tmpFile); err != nil {
+				errors = append(errors, fmt.Sprintf("无法计算文件哈希: %v", err))
+				continue
+			}
+			hash := hex.EncodeToString(hasher.Sum(nil))
+
+			// 与 DeleteImageHandler 共用 refCountMu，避免去重命中的并发上传与并发删除
+			// 交错执行导致 RefCount 读-改-写序列丢失更新
+			refCountMu.Lock()
+			existing, hit, lookupErr := store.LookupByHash(hash)
+			var saveErr error
+			if lookupErr == nil && hit {
+				existing.RefCount++
+				saveErr = store.SaveInfo(existing)
+			}
+			refCountMu.Unlock()
+
+			if lookupErr == nil && hit {
+				if saveErr != nil {
+					errors = append(errors, fmt.Sprintf("无法更新引用计数: %v", saveErr))
+					continue
+				}
+
+				bus.Publish(ctx, string(events.ImageUploaded), events.Event{
+					Type:      events.ImageUploaded,
+					Sequence:  events.NextSequence(),
+					Timestamp: time.Now(),
+					ActorIP:   c.ClientIP(),
+					Image:     existing,
+				})
+
+				url := store.GetURL(existing.ID, storage.Original, storage.ImageOrientation(existing.Orientation), storage.OriginalSize)
+				results = append(results, map[string]string{"original": url})
+				continue
+			}
+
 			// 重置文件指针
 			if _, err = tmpFile.Seek(0, 0); err != nil {
 				errors = append(errors, fmt.Sprintf("无法重置文件指针: %v", err))
@@ -108,8 +229,25 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 			options.Quality = cfg.ImageQuality
 			options.CompressionLevel = cfg.CompressionEffort
 			options.Lossless = cfg.ForceLossless
+			options.Thumbnails = []int{128, 256, 512, 1024}
+
+			if quality := c.PostForm("quality"); quality != "" {
+				if parsed, err := strconv.Atoi(quality); err == nil {
+					options.Quality = parsed
+				}
+			}
+			if effort := c.PostForm("effort"); effort != "" {
+				if parsed, err := strconv.Atoi(effort); err == nil {
+					options.CompressionLevel = parsed
+				}
+			}
+			if lossless := c.PostForm("lossless"); lossless != "" {
+				if parsed, err := strconv.ParseBool(lossless); err == nil {
+					options.Lossless = parsed
+				}
+			}
 
-			data, info, err := converter.ConvertFromReader(tmpFile, options)
+			data, thumbnails, info, err := converter.ConvertFromReaderMulti(tmpFile, formats, options)
 			if err != nil {
 				errors = append(errors, fmt.Sprintf("无法转换图片 %s: %v", file.Filename, err))
 				continue
@@ -123,25 +261,52 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 			}
 			defer originalReader.Close()
 
+			orientation := storage.ImageOrientation(info.Orientation)
+
 			// 保存原始图片
-			id, err := store.Save(originalReader, file.Filename, storage.Original, storage.ImageOrientation(info.Orientation))
+			id, err := store.Save(ctx, originalReader, filename, storage.Original, orientation)
 			if err != nil {
 				errors = append(errors, fmt.Sprintf("无法保存原始图片: %v", err))
 				continue
 			}
 
-			// 保存转换后的图片
-			webpReader := strings.NewReader(string(data))
-			_, err = store.Save(webpReader, file.Filename, storage.WebP, storage.ImageOrientation(info.Orientation))
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("无法保存 WebP 图片: %v", err))
+			// 保存各目标格式转换后的完整尺寸图片及缩略图变体，供响应式 srcset 使用。
+			// Thumbnails 字段仅记录首个请求格式（formats[0]，即"主格式"）成功保存的宽度列表，
+			// 与 images.go 当前假定单一缩略图格式的逻辑保持兼容
+			var savedThumbnails []int
+			var savedFormats []string
+			variantURLs := make(map[string]string, len(formats))
+			for i, format := range formats {
+				storageFormat := storage.ImageFormat(format)
+
+				variantReader := strings.NewReader(string(data[format]))
+				if err := store.SaveVariant(ctx, id, variantReader, filename, storageFormat, orientation, storage.OriginalSize); err != nil {
+					errors = append(errors, fmt.Sprintf("无法保存 %s 图片: %v", format, err))
+					continue
+				}
+				variantURLs[string(format)] = store.GetURL(id, storageFormat, orientation, storage.OriginalSize)
+				savedFormats = append(savedFormats, string(format))
+
+				for width, thumbData := range thumbnails[format] {
+					thumbReader := strings.NewReader(string(thumbData))
+					if err := store.SaveVariant(ctx, id, thumbReader, filename, storageFormat, orientation, width); err != nil {
+						errors = append(errors, fmt.Sprintf("无法保存 %s 格式 %d 宽度缩略图: %v", format, width, err))
+						continue
+					}
+					if i == 0 {
+						savedThumbnails = append(savedThumbnails, width)
+					}
+				}
+			}
+			if len(variantURLs) == 0 {
+				errors = append(errors, fmt.Sprintf("文件 %s 的所有目标格式均保存失败", file.Filename))
 				continue
 			}
 
 			// 保存图片信息
 			imageInfo := &storage.ImageInfo{
 				ID:          id,
-				Filename:    file.Filename,
+				Filename:    filename,
 				StoragePath: filepath.Join("original", info.Orientation),
 				Size:        file.Size,
 				Width:       info.Width,
@@ -152,6 +317,13 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 				CreatedAt:   time.Now(),
 				ExpiresAt:   time.Time{},
 				HasExpiry:   false,
+				Thumbnails:  savedThumbnails,
+				Frames:      info.Frames,
+				DurationMs:  info.DurationMs,
+				Formats:     savedFormats,
+				SHA256:      hash,
+				RefCount:    1,
+				MIME:        mimeType,
 			}
 
 			if err := store.SaveInfo(imageInfo); err != nil {
@@ -159,23 +331,31 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 				continue
 			}
 
-			// 获取图片URL
-			url := store.GetURL(id, storage.Original, storage.ImageOrientation(info.Orientation))
-			urls = append(urls, url)
+			bus.Publish(ctx, string(events.ImageUploaded), events.Event{
+				Type:      events.ImageUploaded,
+				Sequence:  events.NextSequence(),
+				Timestamp: time.Now(),
+				ActorIP:   c.ClientIP(),
+				Image:     imageInfo,
+			})
+
+			// 汇总原始图片及各格式变体的URL
+			variantURLs["original"] = store.GetURL(id, storage.Original, orientation, storage.OriginalSize)
+			results = append(results, variantURLs)
 		}
 
 		// 返回响应
 		if len(errors) == 0 {
 			c.JSON(http.StatusOK, UploadResponse{
 				Success: true,
-				Message: fmt.Sprintf("成功上传 %d 张图片", len(urls)),
-				Data:    urls,
+				Message: fmt.Sprintf("成功上传 %d 张图片", len(results)),
+				Data:    results,
 			})
-		} else if len(urls) > 0 {
+		} else if len(results) > 0 {
 			c.JSON(http.StatusOK, UploadResponse{
 				Success: true,
-				Message: fmt.Sprintf("部分图片上传成功（%d/%d）", len(urls), len(files)),
-				Data:    urls,
+				Message: fmt.Sprintf("部分图片上传成功（%d/%d）", len(results), len(files)),
+				Data:    results,
 				Errors:  errors,
 			})
 		} else {
@@ -188,15 +368,27 @@ func UploadHandler(cfg *config.Config, store storage.Storage) gin.HandlerFunc {
 	}
 }
 
-// 检查文件类型是否允许
-func isAllowedImageType(ext string) bool {
-	allowedTypes := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
-		".avif": true,
+// extensionForMIME 返回魔数嗅探出的 MIME 类型对应的规范扩展名，
+// 未识别的 MIME 类型返回 ok=false
+func extensionForMIME(mimeType string) (ext string, ok bool) {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg", true
+	case "image/png":
+		return ".png", true
+	case "image/gif":
+		return ".gif", true
+	case "image/webp":
+		return ".webp", true
+	case "image/avif":
+		return ".avif", true
+	case "image/bmp":
+		return ".bmp", true
+	case "image/tiff":
+		return ".tiff", true
+	case "image/heic":
+		return ".heic", true
+	default:
+		return "", false
 	}
-	return allowedTypes[ext]
 }
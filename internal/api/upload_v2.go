@@ -0,0 +1,350 @@
+package api
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/events"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/emper0r/InfiniteImages/pkg/converter"
+	"github.com/gin-gonic/gin"
+)
+
+// UploadResultV2 描述一张图片在 /api/v2/upload 下的结构化上传结果
+type UploadResultV2 struct {
+	ID          string         `json:"id"`
+	OriginalURL string         `json:"original_url"`
+	WebPURL     string         `json:"webp_url"`
+	Thumbnails  map[int]string `json:"thumbnails,omitempty"`
+}
+
+// UploadResponseV2 表示 /api/v2/upload 的结构化响应
+type UploadResponseV2 struct {
+	Success bool             `json:"success"`
+	Message string           `json:"message"`
+	Data    []UploadResultV2 `json:"data,omitempty"`
+	Errors  []string         `json:"errors,omitempty"`
+}
+
+// presetBounds 返回预设名称对应的最大宽高约束（0 表示该维度不设限）。
+// 未识别的预设名或 "original" 一律不设限，交由 max_width/max_height 表单字段单独控制。
+func presetBounds(preset string) (maxWidth, maxHeight int) {
+	switch preset {
+	case "thumb":
+		return 320, 320
+	case "web":
+		return 1920, 1920
+	case "print":
+		return 4096, 4096
+	default:
+		return 0, 0
+	}
+}
+
+// fitWithinBounds 按原始宽高比计算落在 maxWidth/maxHeight 限制内的目标尺寸，
+// 只缩小不放大；maxWidth/maxHeight 均为 0 时返回 (0, 0) 表示不缩放
+func fitWithinBounds(srcWidth, srcHeight, maxWidth, maxHeight int) (width, height int) {
+	if maxWidth <= 0 && maxHeight <= 0 {
+		return 0, 0
+	}
+
+	width, height = srcWidth, srcHeight
+	if maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+
+	if width >= srcWidth && height >= srcHeight {
+		return 0, 0
+	}
+	return width, height
+}
+
+// parseThumbnailWidths 解析形如 "160,320,640,1280" 的缩略图宽度 CSV，忽略无法解析或非正的项
+func parseThumbnailWidths(csv string) []int {
+	if csv == "" {
+		return nil
+	}
+	var widths []int
+	for _, part := range strings.Split(csv, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || width <= 0 {
+			continue
+		}
+		widths = append(widths, width)
+	}
+	return widths
+}
+
+// compressToByteBudget 在 maxBytes > 0 时反复降低质量重新编码，直到结果落在预算内
+// 或质量降到下限为止，返回最后一次编码结果（即便仍超出预算，也好过彻底失败）
+func compressToByteBudget(reader func() io.Reader, options converter.ConvertOptions, maxBytes int64) ([]byte, map[int][]byte, converter.ImageInfo, error) {
+	data, thumbnails, info, err := converter.ConvertFromReader(reader(), options)
+	if err != nil || maxBytes <= 0 {
+		return data, thumbnails, info, err
+	}
+
+	const minQuality = 20
+	const qualityStep = 15
+
+	for int64(len(data)) > maxBytes && options.Quality > minQuality {
+		options.Quality -= qualityStep
+		if options.Quality < minQuality {
+			options.Quality = minQuality
+		}
+		data, thumbnails, info, err = converter.ConvertFromReader(reader(), options)
+		if err != nil {
+			return nil, nil, info, err
+		}
+	}
+
+	return data, thumbnails, info, nil
+}
+
+// UploadHandlerV2 是 UploadHandler 的结构化版本：接受 max_width/max_height/max_bytes/preset/thumbnails
+// 等表单字段对转换流水线做每次请求级别的覆盖，并返回 {id, original_url, webp_url, thumbnails} 的
+// 结构化对象。v1 的 POST /api/upload 仍单独保留，其 Data 为每张图片一个按格式名索引的 URL 映射。
+//
+// 缩放仍复用 pkg/converter 既有的 Lanczos 风格 draw.CatmullRom 流水线（ConvertOptions.Width/Height），
+// 而不是引入第二套基于 disintegration/imaging 的缩放实现，以避免同一服务里并存两套图像缩放代码路径。
+func UploadHandlerV2(cfg *config.Config, store storage.Storage, bus events.EventBus) gin.HandlerFunc {
+	// cfg.validate() 已确保该正则可编译，这里直接信任配置
+	allowedTypePattern := regexp.MustCompile(cfg.AllowedImageTypePattern)
+
+	return func(c *gin.Context) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, UploadResponseV2{
+				Success: false,
+				Message: "无法解析上传表单",
+				Errors:  []string{err.Error()},
+			})
+			return
+		}
+
+		files := form.File["images"]
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, UploadResponseV2{
+				Success: false,
+				Message: "未找到上传的图片",
+			})
+			return
+		}
+
+		if len(files) > cfg.MaxUploadCount {
+			c.JSON(http.StatusBadRequest, UploadResponseV2{
+				Success: false,
+				Message: fmt.Sprintf("上传的图片数量超过限制（最大 %d 张）", cfg.MaxUploadCount),
+			})
+			return
+		}
+
+		preset := c.PostForm("preset")
+		maxWidth, maxHeight := presetBounds(preset)
+		if v, err := strconv.Atoi(c.PostForm("max_width")); err == nil && v > 0 {
+			maxWidth = v
+		}
+		if v, err := strconv.Atoi(c.PostForm("max_height")); err == nil && v > 0 {
+			maxHeight = v
+		}
+		maxBytes, _ := strconv.ParseInt(c.PostForm("max_bytes"), 10, 64)
+
+		thumbnailWidths := parseThumbnailWidths(c.PostForm("thumbnails"))
+		if thumbnailWidths == nil {
+			thumbnailWidths = []int{128, 256, 512, 1024}
+		}
+
+		var results []UploadResultV2
+		var errors []string
+		ctx := c.Request.Context()
+
+		for _, file := range files {
+			if file.Size > cfg.MaxUploadSize {
+				errors = append(errors, fmt.Sprintf("文件 %s 大小超过限制（最大 %d 字节）", file.Filename, cfg.MaxUploadSize))
+				continue
+			}
+
+			ext := strings.ToLower(filepath.Ext(file.Filename))
+
+			src, err := file.Open()
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("无法打开文件 %s: %v", file.Filename, err))
+				continue
+			}
+			defer src.Close()
+
+			tmpFile, err := os.CreateTemp("", "upload-*"+ext)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("无法创建临时文件: %v", err))
+				continue
+			}
+			defer os.Remove(tmpFile.Name())
+			defer tmpFile.Close()
+
+			if _, err = io.Copy(tmpFile, src); err != nil {
+				errors = append(errors, fmt.Sprintf("无法复制文件内容: %v", err))
+				continue
+			}
+
+			// 基于魔数嗅探校验真实内容类型，而非信任客户端文件名后缀，
+			// 与 v1 上传路径 (internal/api/upload.go) 的校验保持同等强度
+			if _, err = tmpFile.Seek(0, 0); err != nil {
+				errors = append(errors, fmt.Sprintf("无法重置文件指针: %v", err))
+				continue
+			}
+			sniffBuf := make([]byte, 512)
+			n, err := tmpFile.Read(sniffBuf)
+			if err != nil && err != io.EOF {
+				errors = append(errors, fmt.Sprintf("无法读取文件内容用于类型嗅探: %v", err))
+				continue
+			}
+			mimeType := http.DetectContentType(sniffBuf[:n])
+			if !allowedTypePattern.MatchString(mimeType) {
+				errors = append(errors, fmt.Sprintf("文件 %s 的实际内容类型 %s 不在允许范围内", file.Filename, mimeType))
+				continue
+			}
+
+			// 嗅探出的类型与文件名后缀不一致时，以真实类型重写存储用的文件名，
+			// 避免例如把 PNG 内容当作 .jpg 存储误导下游按扩展名判断格式
+			filename := file.Filename
+			if realExt, ok := extensionForMIME(mimeType); ok && !strings.EqualFold(ext, realExt) {
+				filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + realExt
+			}
+
+			options := converter.DefaultOptions()
+			options.Quality = cfg.ImageQuality
+			options.CompressionLevel = cfg.CompressionEffort
+			options.Lossless = cfg.ForceLossless
+			options.Thumbnails = thumbnailWidths
+
+			if maxWidth > 0 || maxHeight > 0 {
+				if _, err := tmpFile.Seek(0, 0); err != nil {
+					errors = append(errors, fmt.Sprintf("无法重置文件指针: %v", err))
+					continue
+				}
+				if cfg, _, err := image.DecodeConfig(tmpFile); err == nil {
+					options.Width, options.Height = fitWithinBounds(cfg.Width, cfg.Height, maxWidth, maxHeight)
+				}
+			}
+
+			data, thumbnails, info, err := compressToByteBudget(func() io.Reader {
+				tmpFile.Seek(0, 0)
+				return tmpFile
+			}, options, maxBytes)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("无法转换图片 %s: %v", file.Filename, err))
+				continue
+			}
+
+			if _, err = tmpFile.Seek(0, 0); err != nil {
+				errors = append(errors, fmt.Sprintf("无法重置文件指针: %v", err))
+				continue
+			}
+			originalReader, err := os.Open(tmpFile.Name())
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("无法打开原始图片: %v", err))
+				continue
+			}
+			defer originalReader.Close()
+
+			orientation := storage.ImageOrientation(info.Orientation)
+
+			id, err := store.Save(ctx, originalReader, filename, storage.Original, orientation)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("无法保存原始图片: %v", err))
+				continue
+			}
+
+			webpReader := strings.NewReader(string(data))
+			if err := store.SaveVariant(ctx, id, webpReader, filename, storage.WebP, orientation, storage.OriginalSize); err != nil {
+				errors = append(errors, fmt.Sprintf("无法保存 WebP 图片: %v", err))
+				continue
+			}
+
+			var savedThumbnails []int
+			thumbnailURLs := make(map[int]string, len(thumbnails))
+			for width, thumbData := range thumbnails {
+				thumbReader := strings.NewReader(string(thumbData))
+				if err := store.SaveVariant(ctx, id, thumbReader, filename, storage.WebP, orientation, width); err != nil {
+					errors = append(errors, fmt.Sprintf("无法保存 %d 宽度缩略图: %v", width, err))
+					continue
+				}
+				savedThumbnails = append(savedThumbnails, width)
+				thumbnailURLs[width] = store.GetURL(id, storage.WebP, orientation, width)
+			}
+
+			imageInfo := &storage.ImageInfo{
+				ID:          id,
+				Filename:    filename,
+				StoragePath: filepath.Join("original", info.Orientation),
+				Size:        file.Size,
+				Width:       info.Width,
+				Height:      info.Height,
+				Format:      string(info.Format),
+				Orientation: info.Orientation,
+				Tags:        []string{},
+				CreatedAt:   time.Now(),
+				ExpiresAt:   time.Time{},
+				HasExpiry:   false,
+				Thumbnails:  savedThumbnails,
+				Frames:      info.Frames,
+				DurationMs:  info.DurationMs,
+				Formats:     []string{string(storage.WebP)},
+			}
+
+			if err := store.SaveInfo(imageInfo); err != nil {
+				errors = append(errors, fmt.Sprintf("无法保存图片信息: %v", err))
+				continue
+			}
+
+			bus.Publish(ctx, string(events.ImageUploaded), events.Event{
+				Type:      events.ImageUploaded,
+				Sequence:  events.NextSequence(),
+				Timestamp: time.Now(),
+				ActorIP:   c.ClientIP(),
+				Image:     imageInfo,
+			})
+
+			results = append(results, UploadResultV2{
+				ID:          id,
+				OriginalURL: store.GetURL(id, storage.Original, orientation, storage.OriginalSize),
+				WebPURL:     store.GetURL(id, storage.WebP, orientation, storage.OriginalSize),
+				Thumbnails:  thumbnailURLs,
+			})
+		}
+
+		if len(errors) == 0 {
+			c.JSON(http.StatusOK, UploadResponseV2{
+				Success: true,
+				Message: fmt.Sprintf("成功上传 %d 张图片", len(results)),
+				Data:    results,
+			})
+		} else if len(results) > 0 {
+			c.JSON(http.StatusOK, UploadResponseV2{
+				Success: true,
+				Message: fmt.Sprintf("部分图片上传成功（%d/%d）", len(results), len(files)),
+				Data:    results,
+				Errors:  errors,
+			})
+		} else {
+			c.JSON(http.StatusBadRequest, UploadResponseV2{
+				Success: false,
+				Message: "所有图片上传失败",
+				Errors:  errors,
+			})
+		}
+	}
+}
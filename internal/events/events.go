@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+)
+
+// EventType 表示图片生命周期事件的类型
+type EventType string
+
+const (
+	// ImageUploaded 一张图片（及其派生变体）成功保存
+	ImageUploaded EventType = "image.uploaded"
+	// ImageDeleted 一张图片被删除
+	ImageDeleted EventType = "image.deleted"
+	// ImageTagsUpdated 一张图片的标签被更新
+	ImageTagsUpdated EventType = "image.tags_updated"
+	// ImageExpiredCleanup 一批过期图片被清理，Count 记录本次清理的数量
+	ImageExpiredCleanup EventType = "image.expired_cleanup"
+)
+
+// Event 表示一次图片生命周期变更，以 JSON 形式发布到下游（搜索索引、CDN 刷新、审核队列等）
+type Event struct {
+	Type      EventType          `json:"type"`
+	Sequence  int64              `json:"sequence"`  // 单实例内单调递增的序号，用于下游去重/排序
+	Timestamp time.Time          `json:"timestamp"`
+	ActorIP   string             `json:"actorIp"`
+	Image     *storage.ImageInfo `json:"image,omitempty"`
+	Count     int                `json:"count,omitempty"` // 仅 ImageExpiredCleanup 使用，记录本次清理数量
+}
+
+// EventBus 定义图片生命周期事件的发布接口
+type EventBus interface {
+	// Publish 发布一个事件到指定 topic。实现必须是非阻塞的：发布失败或 broker
+	// 不可用不得拖慢或拒绝调用方的 HTTP 请求。
+	Publish(ctx context.Context, topic string, event Event)
+
+	// Close 停止后台发送协程，在 ctx 超时前尽量耗尽已入队的事件
+	Close(ctx context.Context) error
+}
+
+var sequence int64
+
+// NextSequence 返回本进程内单调递增的事件序号
+func NextSequence() int64 {
+	return atomic.AddInt64(&sequence, 1)
+}
+
+// NewEventBus 根据配置创建事件总线；KAFKA_ENABLED 为 false 时返回空操作实现，
+// 使未启用事件流的既有部署不受影响
+func NewEventBus(cfg *config.Config) EventBus {
+	if !cfg.KafkaEnabled {
+		return NewNoopBus()
+	}
+	return NewKafkaBus(cfg)
+}
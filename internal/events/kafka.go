@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/emper0r/InfiniteImages/config"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// eventQueueSize 是发布队列的缓冲区大小，超出后新事件会被直接丢弃而不是阻塞调用方
+const eventQueueSize = 1024
+
+// queuedEvent 是排队等待后台协程发送的一条事件
+type queuedEvent struct {
+	topic string
+	event Event
+}
+
+// kafkaBus 通过 segmentio/kafka-go 将事件发布到 Kafka。发布调用只负责把事件放入
+// 有缓冲 channel，真正的网络 I/O 由单独的 worker 协程完成，这样 Kafka 故障或延迟
+// 不会拖慢或拒绝触发事件的 HTTP 请求。
+type kafkaBus struct {
+	writer      *kafka.Writer
+	topicPrefix string
+	queue       chan queuedEvent
+	done        chan struct{}
+}
+
+// NewKafkaBus 创建一个 Kafka 支持的事件总线，并启动后台发送协程
+func NewKafkaBus(cfg *config.Config) EventBus {
+	brokers := strings.Split(cfg.KafkaBrokers, ",")
+
+	b := &kafkaBus{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Balancer: &kafka.LeastBytes{},
+		},
+		topicPrefix: cfg.KafkaTopicPrefix,
+		queue:       make(chan queuedEvent, eventQueueSize),
+		done:        make(chan struct{}),
+	}
+
+	go b.worker()
+
+	return b
+}
+
+// Publish 将事件放入发布队列；队列已满时直接丢弃并记录日志，保证非阻塞
+func (b *kafkaBus) Publish(ctx context.Context, topic string, event Event) {
+	select {
+	case b.queue <- queuedEvent{topic: topic, event: event}:
+	default:
+		log.Printf("警告: 事件发布队列已满，丢弃事件 %s (topic=%s)", event.Type, topic)
+	}
+}
+
+// worker 串行消费发布队列，直到 Close 关闭队列且已入队事件全部处理完毕
+func (b *kafkaBus) worker() {
+	defer close(b.done)
+	for qe := range b.queue {
+		b.write(qe)
+	}
+}
+
+func (b *kafkaBus) write(qe queuedEvent) {
+	data, err := json.Marshal(qe.event)
+	if err != nil {
+		log.Printf("警告: 无法序列化事件 %s: %v", qe.event.Type, err)
+		return
+	}
+
+	msg := kafka.Message{
+		Topic: b.topicPrefix + qe.topic,
+		Value: data,
+	}
+
+	if err := b.writer.WriteMessages(context.Background(), msg); err != nil {
+		log.Printf("警告: 发布事件到 Kafka 失败 (topic=%s): %v", msg.Topic, err)
+	}
+}
+
+// Close 关闭发布队列并等待 worker 协程耗尽剩余事件，供 main.go 优雅关闭时调用；
+// 若在 ctx 超时前未排空则放弃等待并返回错误
+func (b *kafkaBus) Close(ctx context.Context) error {
+	close(b.queue)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return fmt.Errorf("关闭 Kafka 事件总线超时: %w", ctx.Err())
+	}
+	return b.writer.Close()
+}
@@ -0,0 +1,15 @@
+package events
+
+import "context"
+
+// noopBus 是 KAFKA_ENABLED=false 时使用的空操作事件总线
+type noopBus struct{}
+
+// NewNoopBus 创建一个空操作事件总线
+func NewNoopBus() EventBus {
+	return &noopBus{}
+}
+
+func (b *noopBus) Publish(ctx context.Context, topic string, event Event) {}
+
+func (b *noopBus) Close(ctx context.Context) error { return nil }
@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emper0r/InfiniteImages/internal/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GridFSStorage 基于 MongoDB GridFS 实现存储接口
+type GridFSStorage struct {
+	client *mongo.Client
+	db     *mongo.Database
+	bucket *gridfs.Bucket
+}
+
+// gridFSMetadata 保存在 GridFS 文件文档 metadata 字段中的图片元数据
+type gridFSMetadata struct {
+	Format      string    `bson:"format"`
+	Orientation string    `bson:"orientation"`
+	Width       int       `bson:"width"`
+	Height      int       `bson:"height"`
+	SizeBytes   int64     `bson:"sizeBytes"`
+	Filename    string    `bson:"filename"`
+	Tags        []string  `bson:"tags"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+	HasExpiry   bool      `bson:"hasExpiry"`
+	SHA256      string    `bson:"sha256"`
+	RefCount    int       `bson:"refCount"`
+}
+
+// NewGridFSStorage 创建 GridFS 存储实例
+func NewGridFSStorage(uri, dbName, bucketName string) (Storage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("无法连接 MongoDB: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("无法连通 MongoDB: %w", err)
+	}
+
+	db := client.Database(dbName)
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		return nil, fmt.Errorf("无法创建 GridFS bucket: %w", err)
+	}
+
+	return &GridFSStorage{client: client, db: db, bucket: bucket}, nil
+}
+
+// gridFSFilename 构建 GridFS 内的文件名，格式为 {id}/{orientation}/{format}，
+// 与对象存储驱动按层级组织 key 的习惯保持一致
+func gridFSFilename(id string, format ImageFormat, orientation ImageOrientation) string {
+	return fmt.Sprintf("%s/%s/%s", id, orientation, format)
+}
+
+// Save 保存图片到 GridFS，生成新的图片ID
+func (s *GridFSStorage) Save(ctx context.Context, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error) {
+	_, span := tracing.Tracer.Start(ctx, "storage.save")
+	defer span.End()
+
+	id := generateID()
+	if err := s.upload(id, reader, filename, format, orientation); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SaveVariant 在已有图片ID下保存派生变体（不同格式/方向组合）
+func (s *GridFSStorage) SaveVariant(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.save_variant")
+	defer span.End()
+
+	// GridFS 驱动暂不支持按宽度细分变体，width 仅用于与本地驱动保持接口一致
+	return s.upload(id, reader, filename, format, orientation)
+}
+
+func (s *GridFSStorage) upload(id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) error {
+	name := gridFSFilename(id, format, orientation)
+
+	// 覆盖写入前先删除同名旧文件，避免 GridFS 中残留多个版本
+	_ = s.deleteByName(name)
+
+	meta := gridFSMetadata{
+		Format:      string(format),
+		Orientation: string(orientation),
+		Filename:    filename,
+		CreatedAt:   time.Now(),
+	}
+
+	uploadOpts := options.GridFSUpload().SetMetadata(meta)
+	_, err := s.bucket.UploadFromStream(name, reader, uploadOpts)
+	if err != nil {
+		return fmt.Errorf("无法写入 GridFS 文件 %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete 从 GridFS 删除图片
+func (s *GridFSStorage) Delete(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) error {
+	return s.DeleteVariant(ctx, id, format, orientation, OriginalSize)
+}
+
+// DeleteVariant 删除指定格式的变体；GridFS 驱动暂不支持按宽度细分变体（见 SaveVariant），
+// width 仅用于与本地驱动保持接口一致
+func (s *GridFSStorage) DeleteVariant(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.delete")
+	defer span.End()
+
+	name := gridFSFilename(id, format, orientation)
+	return s.deleteByName(name)
+}
+
+func (s *GridFSStorage) deleteByName(name string) error {
+	ctx := context.Background()
+	cursor, err := s.bucket.Find(bson.M{"filename": name})
+	if err != nil {
+		return fmt.Errorf("无法查找 GridFS 文件: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	found := false
+	for cursor.Next(ctx) {
+		found = true
+		var doc struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		if err := s.bucket.Delete(doc.ID); err != nil {
+			return fmt.Errorf("无法删除 GridFS 文件 %s: %w", name, err)
+		}
+	}
+
+	if !found {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// Get 从 GridFS 获取图片的下载流
+func (s *GridFSStorage) Get(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error) {
+	_, span := tracing.Tracer.Start(ctx, "storage.get")
+	defer span.End()
+
+	name := gridFSFilename(id, format, orientation)
+
+	var buf bytes.Buffer
+	_, err := s.bucket.DownloadToStreamByName(name, &buf)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("无法读取 GridFS 文件 %s: %w", name, err)
+	}
+
+	return io.NopCloser(&buf), nil
+}
+
+// GetURL 返回由 API 层代理流式下载的路由 /api/images/{id}/raw?format=xxx。该地址不带签名，
+// width 与 orientation 参数被忽略
+func (s *GridFSStorage) GetURL(id string, format ImageFormat, orientation ImageOrientation, width int) string {
+	return fmt.Sprintf("/api/images/%s/raw?format=%s", id, format)
+}
+
+// List 列出所有图片（以 original 变体为准）
+func (s *GridFSStorage) List() ([]ImageInfo, error) {
+	ctx := context.Background()
+	// 按文件名而非 metadata.format 过滤：SaveInfo 会用图片格式覆盖 metadata.format
+	filter := bson.M{"filename": bson.M{"$regex": "/original$"}}
+	cursor, err := s.bucket.Find(filter)
+	if err != nil {
+		return nil, fmt.Errorf("无法查询 GridFS 文件列表: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var images []ImageInfo
+	for cursor.Next(ctx) {
+		info, err := decodeGridFSDocument(cursor)
+		if err != nil {
+			continue
+		}
+		images = append(images, *info)
+	}
+
+	return images, nil
+}
+
+// GetInfo 获取图片信息（从 original 变体的 metadata 还原）
+func (s *GridFSStorage) GetInfo(id string) (*ImageInfo, error) {
+	ctx := context.Background()
+	cursor, err := s.bucket.Find(bson.M{"filename": bson.M{"$regex": "^" + id + "/[^/]+/original$"}})
+	if err != nil {
+		return nil, fmt.Errorf("无法查询 GridFS 文件: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		return nil, ErrFileNotFound
+	}
+
+	return decodeGridFSDocument(cursor)
+}
+
+func decodeGridFSDocument(cursor *mongo.Cursor) (*ImageInfo, error) {
+	var doc struct {
+		Filename string         `bson:"filename"`
+		Length   int64          `bson:"length"`
+		Metadata gridFSMetadata `bson:"metadata"`
+	}
+	if err := cursor.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("无法解析 GridFS 元数据: %w", err)
+	}
+
+	parts := strings.SplitN(doc.Filename, "/", 2)
+	id := doc.Filename
+	if len(parts) > 0 {
+		id = parts[0]
+	}
+
+	return &ImageInfo{
+		ID:          id,
+		Filename:    doc.Metadata.Filename,
+		StoragePath: doc.Filename,
+		Size:        doc.Length,
+		Width:       doc.Metadata.Width,
+		Height:      doc.Metadata.Height,
+		Format:      doc.Metadata.Format,
+		Orientation: doc.Metadata.Orientation,
+		Tags:        doc.Metadata.Tags,
+		CreatedAt:   doc.Metadata.CreatedAt,
+		ExpiresAt:   doc.Metadata.ExpiresAt,
+		HasExpiry:   doc.Metadata.HasExpiry,
+		SHA256:      doc.Metadata.SHA256,
+		RefCount:    doc.Metadata.RefCount,
+	}, nil
+}
+
+// SaveInfo 将图片信息合并写入对应 GridFS 文件的 metadata 字段
+func (s *GridFSStorage) SaveInfo(info *ImageInfo) error {
+	ctx := context.Background()
+	orientation := ImageOrientation(info.Orientation)
+	name := gridFSFilename(info.ID, Original, orientation)
+
+	filesColl := s.db.Collection(fmt.Sprintf("%s.files", s.bucketName()))
+
+	meta := gridFSMetadata{
+		Format:      info.Format,
+		Orientation: info.Orientation,
+		Width:       info.Width,
+		Height:      info.Height,
+		SizeBytes:   info.Size,
+		Filename:    info.Filename,
+		Tags:        info.Tags,
+		CreatedAt:   info.CreatedAt,
+		ExpiresAt:   info.ExpiresAt,
+		HasExpiry:   info.HasExpiry,
+		SHA256:      info.SHA256,
+		RefCount:    info.RefCount,
+	}
+
+	_, err := filesColl.UpdateOne(ctx,
+		bson.M{"filename": name},
+		bson.M{"$set": bson.M{"metadata": meta}},
+	)
+	if err != nil {
+		return fmt.Errorf("无法更新 GridFS 元数据: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteInfo 对 GridFS 驱动而言，元数据存放在 original 变体的文件文档上，随 Delete 删除该文件
+// 一并消失，此处为空操作
+func (s *GridFSStorage) DeleteInfo(id string) error {
+	return nil
+}
+
+// LookupByHash 线性扫描 original 变体文档，查找内容寻址去重所需的哈希命中
+func (s *GridFSStorage) LookupByHash(hash string) (*ImageInfo, bool, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, info := range images {
+		if info.SHA256 == hash {
+			return &info, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// CleanExpired 清理过期图片
+func (s *GridFSStorage) CleanExpired(ctx context.Context) (int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.clean_expired")
+	defer span.End()
+
+	now := time.Now()
+	filter := bson.M{
+		"metadata.hasExpiry": true,
+		"metadata.expiresAt": bson.M{"$lt": now},
+	}
+
+	cursor, err := s.bucket.Find(filter)
+	if err != nil {
+		return 0, fmt.Errorf("无法查询过期文件: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		if err := s.bucket.Delete(doc.ID); err == nil {
+			count++
+		}
+	}
+
+	span.AddEvent("cleanup.completed", trace.WithAttributes(attribute.Int("cleanup.count", count)))
+
+	return count, nil
+}
+
+// CleanOrphans 对 GridFS 驱动而言元数据与文件本身存储在同一个文档中，不存在孤立的可能，因此为空操作
+func (s *GridFSStorage) CleanOrphans() (int, int, error) {
+	return 0, 0, nil
+}
+
+// CreateUploadSession GridFS 驱动暂不支持断点续传分片上传
+func (s *GridFSStorage) CreateUploadSession(filename string, totalSize, chunkSize int64) (string, error) {
+	return "", fmt.Errorf("gridfs 驱动暂不支持断点续传上传")
+}
+
+// OpenChunk GridFS 驱动暂不支持断点续传分片上传
+func (s *GridFSStorage) OpenChunk(sessionID string, offset int64) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("gridfs 驱动暂不支持断点续传上传")
+}
+
+// FinalizeChunked GridFS 驱动暂不支持断点续传分片上传
+func (s *GridFSStorage) FinalizeChunked(sessionID string) (*ImageInfo, error) {
+	return nil, fmt.Errorf("gridfs 驱动暂不支持断点续传上传")
+}
+
+// CancelUploadSession GridFS 驱动暂不支持断点续传分片上传
+func (s *GridFSStorage) CancelUploadSession(sessionID string) error {
+	return fmt.Errorf("gridfs 驱动暂不支持断点续传上传")
+}
+
+// SetStorageClass GridFS 驱动暂不支持存储分层
+func (s *GridFSStorage) SetStorageClass(id string, class StorageClass) error {
+	return fmt.Errorf("gridfs 驱动暂不支持存储分层")
+}
+
+// Restore GridFS 驱动暂不支持存储分层
+func (s *GridFSStorage) Restore(id string, days int) error {
+	return fmt.Errorf("gridfs 驱动暂不支持存储分层")
+}
+
+func (s *GridFSStorage) bucketName() string {
+	name := os.Getenv("MONGO_BUCKET")
+	if name == "" {
+		name = "images"
+	}
+	return name
+}
+
+// 注册 GridFS 存储
+func init() {
+	RegisterStorage("gridfs", func() (Storage, error) {
+		uri := os.Getenv("MONGO_URI")
+		dbName := os.Getenv("MONGO_DB")
+		if dbName == "" {
+			dbName = "infiniteimages"
+		}
+		bucketName := os.Getenv("MONGO_BUCKET")
+		if bucketName == "" {
+			bucketName = "images"
+		}
+		return NewGridFSStorage(uri, dbName, bucketName)
+	})
+}
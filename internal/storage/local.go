@@ -1,18 +1,25 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/emper0r/InfiniteImages/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LocalStorage 实现本地文件系统存储
 type LocalStorage struct {
-	basePath string // 基础存储路径
+	basePath  string     // 基础存储路径
+	sessionMu sync.Mutex // 保护断点续传会话元数据的并发读写
 }
 
 // NewLocalStorage 创建本地存储实例
@@ -66,14 +73,42 @@ func ensureDirectories(basePath string) error {
 		return err
 	}
 
+	// 创建断点续传会话目录
+	if err := os.MkdirAll(filepath.Join(basePath, "sessions"), 0755); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // Save 保存图片到本地文件系统
-func (s *LocalStorage) Save(reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error) {
+func (s *LocalStorage) Save(ctx context.Context, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.save")
+	defer span.End()
+
 	// 生成唯一ID
 	id := generateID()
+	span.SetAttributes(attribute.String("image.id", id))
+
+	if err := s.writeFile(id, reader, filename, format, orientation, OriginalSize); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// SaveVariant 在已有图片ID下保存指定格式/尺寸的派生变体，width 非 0 时使用
+// {id}_{width}.{ext} 的尺寸后缀布局，使同一张图片的多个尺寸共存于同一目录下。
+func (s *LocalStorage) SaveVariant(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.save_variant")
+	defer span.End()
+	span.SetAttributes(attribute.String("image.id", id))
+
+	return s.writeFile(id, reader, filename, format, orientation, width)
+}
 
+// writeFile 将图片数据写入指定格式/方向/尺寸对应的文件
+func (s *LocalStorage) writeFile(id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
 	// 构建存储路径
 	var dirPath string
 	if format == Original {
@@ -84,7 +119,7 @@ func (s *LocalStorage) Save(reader io.Reader, filename string, format ImageForma
 
 	// 确保目录存在
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return "", fmt.Errorf("无法创建目录 %s: %w", dirPath, err)
+		return fmt.Errorf("无法创建目录 %s: %w", dirPath, err)
 	}
 
 	// 构建文件路径
@@ -92,31 +127,58 @@ func (s *LocalStorage) Save(reader io.Reader, filename string, format ImageForma
 	if format != Original {
 		ext = "." + strings.ToLower(string(format))
 	}
-	filePath := filepath.Join(dirPath, id+ext)
+	filePath := filepath.Join(dirPath, sizedFilename(id, width, ext))
 
 	// 创建文件
 	file, err := os.Create(filePath)
 	if err != nil {
-		return "", fmt.Errorf("无法创建文件 %s: %w", filePath, err)
+		return fmt.Errorf("无法创建文件 %s: %w", filePath, err)
 	}
 	defer file.Close()
 
 	// 写入文件
 	_, err = io.Copy(file, reader)
 	if err != nil {
-		return "", fmt.Errorf("无法写入文件 %s: %w", filePath, err)
+		return fmt.Errorf("无法写入文件 %s: %w", filePath, err)
 	}
 
-	return id, nil
+	return nil
+}
+
+// sizedFilename 根据宽度构建文件名，width 为 0（OriginalSize）时不带尺寸后缀
+func sizedFilename(id string, width int, ext string) string {
+	if width <= 0 {
+		return id + ext
+	}
+	return fmt.Sprintf("%s_%d%s", id, width, ext)
+}
+
+// Delete 从本地文件系统删除图片的完整尺寸变体
+func (s *LocalStorage) Delete(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) error {
+	return s.deleteVariant(ctx, id, format, orientation, OriginalSize)
 }
 
-// Delete 从本地文件系统删除图片
-func (s *LocalStorage) Delete(id string, format ImageFormat, orientation ImageOrientation) error {
+// DeleteVariant 删除指定格式/宽度的派生变体，width 为 0（OriginalSize）时等价于 Delete
+func (s *LocalStorage) DeleteVariant(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation, width int) error {
+	return s.deleteVariant(ctx, id, format, orientation, width)
+}
+
+func (s *LocalStorage) deleteVariant(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.delete")
+	defer span.End()
+	span.SetAttributes(attribute.String("image.id", id))
+
+	cold := false
+	if info, err := s.GetInfo(id); err == nil {
+		cold = isCold(info.StorageClass)
+	}
+
+	dirPath := s.tierDir(format, orientation, cold)
+
 	// 构建文件路径
 	var filePath string
 	if format == Original {
 		// 查找原始文件的扩展名
-		dirPath := filepath.Join(s.basePath, "original", string(orientation))
 		matches, err := filepath.Glob(filepath.Join(dirPath, id+".*"))
 		if err != nil {
 			return fmt.Errorf("无法查找文件: %w", err)
@@ -127,7 +189,7 @@ func (s *LocalStorage) Delete(id string, format ImageFormat, orientation ImageOr
 		filePath = matches[0]
 	} else {
 		ext := "." + strings.ToLower(string(format))
-		filePath = filepath.Join(s.basePath, string(format), string(orientation), id+ext)
+		filePath = filepath.Join(dirPath, sizedFilename(id, width, ext))
 	}
 
 	// 删除文件
@@ -142,13 +204,27 @@ func (s *LocalStorage) Delete(id string, format ImageFormat, orientation ImageOr
 	return nil
 }
 
-// Get 从本地文件系统获取图片
-func (s *LocalStorage) Get(id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error) {
+// Get 从本地文件系统获取图片。如果图片处于冷层级且尚未处于有效的取回窗口内，
+// 返回 ErrObjectArchived 而不是直接读取（冷层级文件仍物理存在于 cold/ 子树下）。
+func (s *LocalStorage) Get(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error) {
+	_, span := tracing.Tracer.Start(ctx, "storage.get")
+	defer span.End()
+	span.SetAttributes(attribute.String("image.id", id))
+
+	cold := false
+	if info, err := s.GetInfo(id); err == nil {
+		if isCold(info.StorageClass) && info.RestoreStatus != string(RestoreStatusRestored) {
+			return nil, &ErrObjectArchived{RestoreStatus: info.RestoreStatus}
+		}
+		cold = isCold(info.StorageClass)
+	}
+
+	dirPath := s.tierDir(format, orientation, cold)
+
 	// 构建文件路径
 	var filePath string
 	if format == Original {
 		// 查找原始文件的扩展名
-		dirPath := filepath.Join(s.basePath, "original", string(orientation))
 		matches, err := filepath.Glob(filepath.Join(dirPath, id+".*"))
 		if err != nil {
 			return nil, fmt.Errorf("无法查找文件: %w", err)
@@ -159,7 +235,7 @@ func (s *LocalStorage) Get(id string, format ImageFormat, orientation ImageOrien
 		filePath = matches[0]
 	} else {
 		ext := "." + strings.ToLower(string(format))
-		filePath = filepath.Join(s.basePath, string(format), string(orientation), id+ext)
+		filePath = filepath.Join(dirPath, id+ext)
 	}
 
 	// 打开文件
@@ -174,13 +250,18 @@ func (s *LocalStorage) Get(id string, format ImageFormat, orientation ImageOrien
 	return file, nil
 }
 
-// GetURL 获取图片的URL
-func (s *LocalStorage) GetURL(id string, format ImageFormat, orientation ImageOrientation) string {
+// GetURL 获取图片的URL，width 为 0 时返回原始尺寸，否则返回对应宽度的缩略图变体
+func (s *LocalStorage) GetURL(id string, format ImageFormat, orientation ImageOrientation, width int) string {
+	name := id
+	if width > 0 {
+		name = fmt.Sprintf("%s_%d", id, width)
+	}
+
 	var path string
 	if format == Original {
-		path = fmt.Sprintf("/static/images/original/%s/%s", orientation, id)
+		path = fmt.Sprintf("/static/images/original/%s/%s", orientation, name)
 	} else {
-		path = fmt.Sprintf("/static/images/%s/%s/%s.%s", format, orientation, id, strings.ToLower(string(format)))
+		path = fmt.Sprintf("/static/images/%s/%s/%s.%s", format, orientation, name, strings.ToLower(string(format)))
 	}
 	return path
 }
@@ -250,6 +331,21 @@ func (s *LocalStorage) SaveInfo(info *ImageInfo) error {
 	return nil
 }
 
+// LookupByHash 线性扫描本地元数据目录，查找内容寻址去重所需的哈希命中。
+// 本地驱动未维护哈希索引，图片数量较大时应仅在上传路径上调用。
+func (s *LocalStorage) LookupByHash(hash string) (*ImageInfo, bool, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, info := range images {
+		if info.SHA256 == hash {
+			return &info, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
 // DeleteInfo 删除图片信息
 func (s *LocalStorage) DeleteInfo(id string) error {
 	metadataPath := filepath.Join(s.basePath, "metadata", id+".json")
@@ -265,7 +361,10 @@ func (s *LocalStorage) DeleteInfo(id string) error {
 }
 
 // CleanExpired 清理过期图片
-func (s *LocalStorage) CleanExpired() (int, error) {
+func (s *LocalStorage) CleanExpired(ctx context.Context) (int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.clean_expired")
+	defer span.End()
+
 	metadataDir := filepath.Join(s.basePath, "metadata")
 	files, err := os.ReadDir(metadataDir)
 	if err != nil {
@@ -289,9 +388,9 @@ func (s *LocalStorage) CleanExpired() (int, error) {
 		// 检查是否过期
 		if info.HasExpiry && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(now) {
 			// 删除所有格式的图片
-			s.Delete(id, Original, ImageOrientation(info.Orientation))
-			s.Delete(id, WebP, ImageOrientation(info.Orientation))
-			s.Delete(id, AVIF, ImageOrientation(info.Orientation))
+			s.Delete(ctx, id, Original, ImageOrientation(info.Orientation))
+			s.Delete(ctx, id, WebP, ImageOrientation(info.Orientation))
+			s.Delete(ctx, id, AVIF, ImageOrientation(info.Orientation))
 
 			// 删除元数据
 			s.DeleteInfo(id)
@@ -300,9 +399,96 @@ func (s *LocalStorage) CleanExpired() (int, error) {
 		}
 	}
 
+	span.AddEvent("cleanup.completed", trace.WithAttributes(attribute.Int("cleanup.count", count)))
+
 	return count, nil
 }
 
+// CleanOrphans 遍历 original/webp/avif/jxl 子目录下的每个文件，提取其 {id}，
+// 删除在 metadata/{id}.json 中没有对应记录的孤立文件；同时反向删除所引用
+// 文件已全部缺失的孤立元数据。这修复了失败的上传或中断的转换遗留的悬挂文件问题。
+func (s *LocalStorage) CleanOrphans() (int, int, error) {
+	metadataDir := filepath.Join(s.basePath, "metadata")
+	knownIDs := make(map[string]bool)
+
+	metaFiles, err := os.ReadDir(metadataDir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("无法读取元数据目录: %w", err)
+	}
+	for _, f := range metaFiles {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		knownIDs[strings.TrimSuffix(f.Name(), ".json")] = true
+	}
+
+	// 这一遍按目录扫描、逐文件判断是否孤立，尚不知道文件所属的图片ID，因而无法按
+	// 单张图片的 Formats 字段细分，需要遍历全部已知格式目录（含 JXL）才能发现
+	// 遗留在各格式目录下的孤儿文件
+	blobsRemoved := 0
+	for _, format := range []ImageFormat{Original, WebP, AVIF, JXL} {
+		for _, orientation := range []ImageOrientation{Landscape, Portrait} {
+			dirPath := filepath.Join(s.basePath, string(format), string(orientation))
+			entries, err := os.ReadDir(dirPath)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					continue
+				}
+				id := idFromFilename(entry.Name())
+				if !knownIDs[id] {
+					if err := os.Remove(filepath.Join(dirPath, entry.Name())); err == nil {
+						blobsRemoved++
+					}
+				}
+			}
+		}
+	}
+
+	// 反向清理：元数据存在，但所有引用的文件都缺失
+	metadataRemoved := 0
+	for id := range knownIDs {
+		info, err := s.GetInfo(id)
+		if err != nil {
+			continue
+		}
+		orientation := ImageOrientation(info.Orientation)
+		hasAny := false
+		formats := append([]ImageFormat{Original}, info.VariantFormats()...)
+		for _, format := range formats {
+			rc, err := s.Get(context.Background(), id, format, orientation)
+			if err == nil {
+				rc.Close()
+				hasAny = true
+				break
+			}
+			// 冷层级且未取回的图片读不出内容，但其文件仍在 cold/ 子树下，不算缺失
+			if _, archived := err.(*ErrObjectArchived); archived {
+				hasAny = true
+				break
+			}
+		}
+		if !hasAny {
+			if err := s.DeleteInfo(id); err == nil {
+				metadataRemoved++
+			}
+		}
+	}
+
+	return blobsRemoved, metadataRemoved, nil
+}
+
+// idFromFilename 从文件名中提取图片ID，去除尺寸后缀（_{width}）和扩展名
+func idFromFilename(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if idx := strings.LastIndex(name, "_"); idx != -1 {
+		return name[:idx]
+	}
+	return name
+}
+
 // 生成唯一ID
 func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
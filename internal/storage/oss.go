@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/emper0r/InfiniteImages/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OSSStorage 基于阿里云 OSS 实现存储接口
+type OSSStorage struct {
+	bucket *oss.Bucket
+	prefix string
+	domain string // 用于拼接公网可访问 URL 的自定义域名，留空时回退到默认的 Bucket 域名
+}
+
+// NewOSSStorage 创建 OSS 存储实例
+func NewOSSStorage(endpoint, accessKeyID, accessKeySecret, bucketName, prefix, customDomain string) (Storage, error) {
+	client, err := oss.New(endpoint, accessKeyID, accessKeySecret)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建 OSS 客户端: %w", err)
+	}
+
+	bucket, err := client.Bucket(bucketName)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取 OSS bucket: %w", err)
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &OSSStorage{bucket: bucket, prefix: prefix, domain: customDomain}, nil
+}
+
+// objectKey 构建指定格式/方向/尺寸图片在 OSS 中的对象键
+func (s *OSSStorage) objectKey(id string, format ImageFormat, orientation ImageOrientation, width int, ext string) string {
+	dir := string(format)
+	if format == Original {
+		dir = "original"
+	} else {
+		ext = "." + strings.ToLower(string(format))
+	}
+	return fmt.Sprintf("%s%s/%s/%s", s.prefix, dir, orientation, sizedFilename(id, width, ext))
+}
+
+func (s *OSSStorage) metadataKey(id string) string {
+	return fmt.Sprintf("%smetadata/%s.json", s.prefix, id)
+}
+
+// Save 保存图片到 OSS，生成新的图片ID
+func (s *OSSStorage) Save(ctx context.Context, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error) {
+	_, span := tracing.Tracer.Start(ctx, "storage.save")
+	defer span.End()
+
+	id := generateID()
+	if err := s.putObject(ctx, id, reader, filename, format, orientation, OriginalSize); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SaveVariant 在已有图片ID下保存派生变体
+func (s *OSSStorage) SaveVariant(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.save_variant")
+	defer span.End()
+
+	return s.putObject(ctx, id, reader, filename, format, orientation, width)
+}
+
+func (s *OSSStorage) putObject(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "oss.putobject")
+	defer span.End()
+
+	ext := extensionOf(filename)
+	key := s.objectKey(id, format, orientation, width, ext)
+	span.SetAttributes(attribute.String("oss.key", key))
+	if err := s.bucket.PutObject(key, reader); err != nil {
+		return fmt.Errorf("无法写入 OSS 对象 %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete 从 OSS 删除图片
+func (s *OSSStorage) Delete(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) error {
+	return s.DeleteVariant(ctx, id, format, orientation, OriginalSize)
+}
+
+// DeleteVariant 删除指定格式/宽度的派生变体，width 为 0（OriginalSize）时等价于 Delete
+func (s *OSSStorage) DeleteVariant(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.delete")
+	defer span.End()
+
+	info, err := s.GetInfo(id)
+	ext := ""
+	if err == nil {
+		ext = extensionOf(info.Filename)
+	}
+	key := s.objectKey(id, format, orientation, width, ext)
+
+	exists, err := s.bucket.IsObjectExist(key)
+	if err != nil {
+		return fmt.Errorf("无法检查 OSS 对象是否存在: %w", err)
+	}
+	if !exists {
+		return ErrFileNotFound
+	}
+
+	if err := s.bucket.DeleteObject(key); err != nil {
+		return fmt.Errorf("无法删除 OSS 对象 %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get 从 OSS 获取图片
+func (s *OSSStorage) Get(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error) {
+	_, span := tracing.Tracer.Start(ctx, "storage.get")
+	defer span.End()
+
+	info, err := s.GetInfo(id)
+	ext := ""
+	if err == nil {
+		ext = extensionOf(info.Filename)
+	}
+	key := s.objectKey(id, format, orientation, OriginalSize, ext)
+
+	body, err := s.bucket.GetObject(key)
+	if err != nil {
+		if ossIsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("无法读取 OSS 对象 %s: %w", key, err)
+	}
+	return body, nil
+}
+
+// GetObjectBytes 按对象键直接下载原始字节，供直传回调处理器在写入最终变体前读取
+// 浏览器刚上传到 OSS 的临时对象
+func (s *OSSStorage) GetObjectBytes(objectKey string) ([]byte, error) {
+	body, err := s.bucket.GetObject(objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("无法下载 OSS 对象 %s: %w", objectKey, err)
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// GetURL 获取图片URL，优先使用自定义域名拼接公网地址
+func (s *OSSStorage) GetURL(id string, format ImageFormat, orientation ImageOrientation, width int) string {
+	ext := ""
+	if info, err := s.GetInfo(id); err == nil {
+		ext = extensionOf(info.Filename)
+	}
+	key := s.objectKey(id, format, orientation, width, ext)
+	if s.domain != "" {
+		return fmt.Sprintf("https://%s/%s", strings.TrimSuffix(s.domain, "/"), key)
+	}
+	endpoint := strings.TrimPrefix(strings.TrimPrefix(s.bucket.Client.Config.Endpoint, "https://"), "http://")
+	return fmt.Sprintf("https://%s.%s/%s", s.bucket.BucketName, endpoint, key)
+}
+
+// List 列出所有图片（以元数据对象为准）
+func (s *OSSStorage) List() ([]ImageInfo, error) {
+	marker := ""
+	var images []ImageInfo
+	metaPrefix := s.prefix + "metadata/"
+
+	for {
+		result, err := s.bucket.ListObjects(oss.Prefix(metaPrefix), oss.Marker(marker))
+		if err != nil {
+			return nil, fmt.Errorf("无法列出 OSS 元数据对象: %w", err)
+		}
+
+		for _, obj := range result.Objects {
+			id := strings.TrimSuffix(strings.TrimPrefix(obj.Key, metaPrefix), ".json")
+			info, err := s.GetInfo(id)
+			if err != nil {
+				continue
+			}
+			images = append(images, *info)
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextMarker
+	}
+
+	return images, nil
+}
+
+// GetInfo 获取图片信息
+func (s *OSSStorage) GetInfo(id string) (*ImageInfo, error) {
+	body, err := s.bucket.GetObject(s.metadataKey(id))
+	if err != nil {
+		if ossIsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("无法读取 OSS 元数据对象: %w", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取元数据内容: %w", err)
+	}
+
+	var info ImageInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("无法解析元数据: %w", err)
+	}
+	return &info, nil
+}
+
+// SaveInfo 保存图片信息
+func (s *OSSStorage) SaveInfo(info *ImageInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化元数据: %w", err)
+	}
+	if err := s.bucket.PutObject(s.metadataKey(info.ID), strings.NewReader(string(data))); err != nil {
+		return fmt.Errorf("无法写入 OSS 元数据对象: %w", err)
+	}
+	return nil
+}
+
+// LookupByHash 线性扫描元数据对象，查找内容寻址去重所需的哈希命中
+func (s *OSSStorage) LookupByHash(hash string) (*ImageInfo, bool, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, info := range images {
+		if info.SHA256 == hash {
+			return &info, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// DeleteInfo 删除图片信息
+func (s *OSSStorage) DeleteInfo(id string) error {
+	key := s.metadataKey(id)
+	exists, err := s.bucket.IsObjectExist(key)
+	if err != nil {
+		return fmt.Errorf("无法检查 OSS 元数据对象是否存在: %w", err)
+	}
+	if !exists {
+		return ErrFileNotFound
+	}
+	if err := s.bucket.DeleteObject(key); err != nil {
+		return fmt.Errorf("无法删除 OSS 元数据对象: %w", err)
+	}
+	return nil
+}
+
+// CleanExpired 清理过期图片
+func (s *OSSStorage) CleanExpired(ctx context.Context) (int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.clean_expired")
+	defer span.End()
+
+	images, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	count := 0
+	for _, info := range images {
+		if info.HasExpiry && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(now) {
+			orientation := ImageOrientation(info.Orientation)
+			s.Delete(ctx, info.ID, Original, orientation)
+			s.Delete(ctx, info.ID, WebP, orientation)
+			s.Delete(ctx, info.ID, AVIF, orientation)
+			s.DeleteInfo(info.ID)
+			count++
+		}
+	}
+
+	span.AddEvent("cleanup.completed", trace.WithAttributes(attribute.Int("cleanup.count", count)))
+
+	return count, nil
+}
+
+// CleanOrphans 对 OSS 驱动而言暂不提供孤立对象扫描（需要遍历整个 bucket 的多级前缀，
+// 成本较高），留空实现，后续可结合生命周期规则在 OSS 侧完成
+func (s *OSSStorage) CleanOrphans() (int, int, error) {
+	return 0, 0, nil
+}
+
+// CreateUploadSession OSS 驱动的大文件走直传 + 回调（见 POST /api/upload/policy），暂不支持服务端分片会话
+func (s *OSSStorage) CreateUploadSession(filename string, totalSize, chunkSize int64) (string, error) {
+	return "", fmt.Errorf("oss 驱动请使用直传签名 (POST /api/upload/policy) 而非分片会话")
+}
+
+// OpenChunk 见 CreateUploadSession
+func (s *OSSStorage) OpenChunk(sessionID string, offset int64) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("oss 驱动请使用直传签名 (POST /api/upload/policy) 而非分片会话")
+}
+
+// FinalizeChunked 见 CreateUploadSession
+func (s *OSSStorage) FinalizeChunked(sessionID string) (*ImageInfo, error) {
+	return nil, fmt.Errorf("oss 驱动请使用直传签名 (POST /api/upload/policy) 而非分片会话")
+}
+
+// CancelUploadSession 见 CreateUploadSession
+func (s *OSSStorage) CancelUploadSession(sessionID string) error {
+	return fmt.Errorf("oss 驱动请使用直传签名 (POST /api/upload/policy) 而非分片会话")
+}
+
+// SetStorageClass OSS 驱动暂不支持存储分层
+func (s *OSSStorage) SetStorageClass(id string, class StorageClass) error {
+	return fmt.Errorf("oss 驱动暂不支持存储分层")
+}
+
+// Restore OSS 驱动暂不支持存储分层
+func (s *OSSStorage) Restore(id string, days int) error {
+	return fmt.Errorf("oss 驱动暂不支持存储分层")
+}
+
+// extensionOf 从文件名中提取扩展名（含 "."）
+func extensionOf(filename string) string {
+	idx := strings.LastIndex(filename, ".")
+	if idx == -1 {
+		return ""
+	}
+	return filename[idx:]
+}
+
+// ossIsNotExist 判断 OSS SDK 返回的错误是否表示对象不存在
+func ossIsNotExist(err error) bool {
+	return strings.Contains(err.Error(), "NoSuchKey") || strings.Contains(err.Error(), "404")
+}
+
+// 注册阿里云 OSS 存储
+func init() {
+	RegisterStorage("oss", func() (Storage, error) {
+		endpoint := os.Getenv("OSS_ENDPOINT")
+		accessKeyID := os.Getenv("OSS_ACCESS_KEY_ID")
+		accessKeySecret := os.Getenv("OSS_ACCESS_KEY_SECRET")
+		bucketName := os.Getenv("OSS_BUCKET")
+		prefix := os.Getenv("OSS_UPLOAD_PREFIX")
+		if prefix == "" {
+			prefix = "uploads/"
+		}
+		customDomain := os.Getenv("OSS_CUSTOM_DOMAIN")
+		return NewOSSStorage(endpoint, accessKeyID, accessKeySecret, bucketName, prefix, customDomain)
+	})
+}
@@ -0,0 +1,38 @@
+package storage
+
+import "fmt"
+
+// Registry 按名称持有多个已构造好的存储实例，供单个运行中的进程按请求选择目标后端
+// （例如上传接口的 backend 表单字段）。这与只选择一个全局后端的 StorageFactory/NewStorage
+// 机制是互补关系：NewStorage 决定进程启动时使用的主存储，Registry 额外登记了其余
+// 配置齐全的后端，供特定请求覆盖默认选择
+type Registry struct {
+	backends map[string]Storage
+	fallback string
+}
+
+// NewRegistry 创建一个存储注册表，fallback 为请求未指定后端（或指定了未登记的名称）时
+// 使用的默认后端名称
+func NewRegistry(fallback string) *Registry {
+	return &Registry{
+		backends: make(map[string]Storage),
+		fallback: fallback,
+	}
+}
+
+// Register 登记一个已构造好的存储实例
+func (r *Registry) Register(name string, store Storage) {
+	r.backends[name] = store
+}
+
+// Resolve 按名称查找后端，name 为空字符串时回退到 fallback
+func (r *Registry) Resolve(name string) (Storage, error) {
+	if name == "" {
+		name = r.fallback
+	}
+	store, ok := r.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的存储后端 %q", name)
+	}
+	return store, nil
+}
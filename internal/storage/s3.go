@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/emper0r/InfiniteImages/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// S3Storage 基于任意 S3 兼容端点（AWS S3、阿里云 OSS、MinIO、Cloudflare R2 等）实现存储接口，
+// 对象/元数据布局与 OSSStorage 一致（元数据以 JSON 对象形式存放在 metadata/ 前缀下），
+// 区别仅在于通过 AWS SDK v2 的自定义 endpoint + path-style 寻址来兼容非 AWS 的实现
+type S3Storage struct {
+	client     *s3.Client
+	presigner  *s3.PresignClient
+	bucket     string
+	prefix     string
+	domain     string        // 公网可访问的自定义域名/CDN 地址，留空时回退到默认的虚拟主机地址
+	presignTTL time.Duration // 大于 0 时 GetURL 返回限时签名地址，而非公开地址
+}
+
+// NewS3Storage 创建 S3 兼容存储实例。endpoint 为空时使用 AWS 官方端点；
+// 非空时按 S3 兼容模式访问自定义端点（MinIO/R2/OSS 等通常需要 path-style 寻址）
+func NewS3Storage(endpoint, region, accessKey, secretKey, bucket, prefix, publicBaseURL string, presignTTL time.Duration) (Storage, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 存储必须提供 bucket 名称")
+	}
+
+	options := s3.Options{
+		Region:       region,
+		Credentials:  credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
+		UsePathStyle: endpoint != "",
+	}
+	if endpoint != "" {
+		options.BaseEndpoint = aws.String(endpoint)
+	}
+	client := s3.New(options)
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &S3Storage{
+		client:     client,
+		presigner:  s3.NewPresignClient(client),
+		bucket:     bucket,
+		prefix:     prefix,
+		domain:     publicBaseURL,
+		presignTTL: presignTTL,
+	}, nil
+}
+
+// objectKey 构建指定格式/方向/尺寸图片在 S3 中的对象键
+func (s *S3Storage) objectKey(id string, format ImageFormat, orientation ImageOrientation, width int, ext string) string {
+	dir := string(format)
+	if format == Original {
+		dir = "original"
+	} else {
+		ext = "." + strings.ToLower(string(format))
+	}
+	return fmt.Sprintf("%s%s/%s/%s", s.prefix, dir, orientation, sizedFilename(id, width, ext))
+}
+
+func (s *S3Storage) metadataKey(id string) string {
+	return fmt.Sprintf("%smetadata/%s.json", s.prefix, id)
+}
+
+// Save 保存图片到 S3，生成新的图片ID
+func (s *S3Storage) Save(ctx context.Context, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error) {
+	_, span := tracing.Tracer.Start(ctx, "storage.save")
+	defer span.End()
+
+	id := generateID()
+	if err := s.putObject(ctx, id, reader, filename, format, orientation, OriginalSize); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SaveVariant 在已有图片ID下保存派生变体
+func (s *S3Storage) SaveVariant(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
+	_, span := tracing.Tracer.Start(ctx, "storage.save_variant")
+	defer span.End()
+
+	return s.putObject(ctx, id, reader, filename, format, orientation, width)
+}
+
+func (s *S3Storage) putObject(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error {
+	ctx, span := tracing.Tracer.Start(ctx, "s3.putobject")
+	defer span.End()
+
+	ext := extensionOf(filename)
+	key := s.objectKey(id, format, orientation, width, ext)
+	span.SetAttributes(attribute.String("s3.key", key))
+
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   reader,
+	}); err != nil {
+		return fmt.Errorf("无法写入 S3 对象 %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete 从 S3 删除图片
+func (s *S3Storage) Delete(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) error {
+	return s.DeleteVariant(ctx, id, format, orientation, OriginalSize)
+}
+
+// DeleteVariant 删除指定格式/宽度的派生变体，width 为 0（OriginalSize）时等价于 Delete
+func (s *S3Storage) DeleteVariant(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation, width int) error {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.delete")
+	defer span.End()
+
+	info, err := s.GetInfo(id)
+	ext := ""
+	if err == nil {
+		ext = extensionOf(info.Filename)
+	}
+	key := s.objectKey(id, format, orientation, width, ext)
+
+	if _, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}); err != nil {
+		if s3IsNotFound(err) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("无法检查 S3 对象是否存在: %w", err)
+	}
+
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}); err != nil {
+		return fmt.Errorf("无法删除 S3 对象 %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get 从 S3 获取图片
+func (s *S3Storage) Get(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.get")
+	defer span.End()
+
+	info, err := s.GetInfo(id)
+	ext := ""
+	if err == nil {
+		ext = extensionOf(info.Filename)
+	}
+	key := s.objectKey(id, format, orientation, OriginalSize, ext)
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		if s3IsNotFound(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("无法读取 S3 对象 %s: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+// GetURL 获取图片URL。配置了 presignTTL 时返回限时签名地址，
+// 否则优先使用自定义域名拼接公开地址
+func (s *S3Storage) GetURL(id string, format ImageFormat, orientation ImageOrientation, width int) string {
+	ext := ""
+	if info, err := s.GetInfo(id); err == nil {
+		ext = extensionOf(info.Filename)
+	}
+	key := s.objectKey(id, format, orientation, width, ext)
+
+	if s.presignTTL > 0 {
+		req, err := s.presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(s.presignTTL))
+		if err == nil {
+			return req.URL
+		}
+		log.Printf("警告: 无法生成 S3 预签名 URL，回退到公开地址: %v", err)
+	}
+
+	if s.domain != "" {
+		return fmt.Sprintf("https://%s/%s", strings.TrimSuffix(s.domain, "/"), key)
+	}
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, key)
+}
+
+// List 列出所有图片（以元数据对象为准）
+func (s *S3Storage) List() ([]ImageInfo, error) {
+	ctx := context.Background()
+	metaPrefix := s.prefix + "metadata/"
+	var images []ImageInfo
+	var token *string
+
+	for {
+		out, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.bucket),
+			Prefix:            aws.String(metaPrefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("无法列出 S3 元数据对象: %w", err)
+		}
+
+		for _, obj := range out.Contents {
+			id := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(obj.Key), metaPrefix), ".json")
+			info, err := s.GetInfo(id)
+			if err != nil {
+				continue
+			}
+			images = append(images, *info)
+		}
+
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+
+	return images, nil
+}
+
+// GetInfo 获取图片信息
+func (s *S3Storage) GetInfo(id string) (*ImageInfo, error) {
+	ctx := context.Background()
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.metadataKey(id))})
+	if err != nil {
+		if s3IsNotFound(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("无法读取 S3 元数据对象: %w", err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取元数据内容: %w", err)
+	}
+
+	var info ImageInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("无法解析元数据: %w", err)
+	}
+	return &info, nil
+}
+
+// SaveInfo 保存图片信息
+func (s *S3Storage) SaveInfo(info *ImageInfo) error {
+	ctx := context.Background()
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化元数据: %w", err)
+	}
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.metadataKey(info.ID)),
+		Body:   strings.NewReader(string(data)),
+	}); err != nil {
+		return fmt.Errorf("无法写入 S3 元数据对象: %w", err)
+	}
+	return nil
+}
+
+// LookupByHash 线性扫描元数据对象，查找内容寻址去重所需的哈希命中
+func (s *S3Storage) LookupByHash(hash string) (*ImageInfo, bool, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, info := range images {
+		if info.SHA256 == hash {
+			return &info, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// DeleteInfo 删除图片信息
+func (s *S3Storage) DeleteInfo(id string) error {
+	ctx := context.Background()
+	key := s.metadataKey(id)
+	if _, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}); err != nil {
+		if s3IsNotFound(err) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("无法检查 S3 元数据对象是否存在: %w", err)
+	}
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}); err != nil {
+		return fmt.Errorf("无法删除 S3 元数据对象: %w", err)
+	}
+	return nil
+}
+
+// CleanExpired 清理过期图片
+func (s *S3Storage) CleanExpired(ctx context.Context) (int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "storage.clean_expired")
+	defer span.End()
+
+	images, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	count := 0
+	for _, info := range images {
+		if info.HasExpiry && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(now) {
+			orientation := ImageOrientation(info.Orientation)
+			s.Delete(ctx, info.ID, Original, orientation)
+			s.Delete(ctx, info.ID, WebP, orientation)
+			s.Delete(ctx, info.ID, AVIF, orientation)
+			s.DeleteInfo(info.ID)
+			count++
+		}
+	}
+
+	span.AddEvent("cleanup.completed", trace.WithAttributes(attribute.Int("cleanup.count", count)))
+
+	return count, nil
+}
+
+// CleanOrphans 对 S3 驱动而言暂不提供孤立对象扫描（需要遍历整个 bucket 的多级前缀，
+// 成本较高），留空实现，后续可结合生命周期规则在存储侧完成
+func (s *S3Storage) CleanOrphans() (int, int, error) {
+	return 0, 0, nil
+}
+
+// CreateUploadSession S3 驱动暂不支持服务端分片会话，大文件建议直接使用客户端分片上传
+// （S3 Multipart Upload）配合预签名 URL，而不经过本服务转发字节
+func (s *S3Storage) CreateUploadSession(filename string, totalSize, chunkSize int64) (string, error) {
+	return "", fmt.Errorf("s3 驱动暂不支持断点续传分片会话")
+}
+
+// OpenChunk 见 CreateUploadSession
+func (s *S3Storage) OpenChunk(sessionID string, offset int64) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("s3 驱动暂不支持断点续传分片会话")
+}
+
+// FinalizeChunked 见 CreateUploadSession
+func (s *S3Storage) FinalizeChunked(sessionID string) (*ImageInfo, error) {
+	return nil, fmt.Errorf("s3 驱动暂不支持断点续传分片会话")
+}
+
+// CancelUploadSession 见 CreateUploadSession
+func (s *S3Storage) CancelUploadSession(sessionID string) error {
+	return fmt.Errorf("s3 驱动暂不支持断点续传分片会话")
+}
+
+// SetStorageClass S3 驱动暂不支持存储分层
+func (s *S3Storage) SetStorageClass(id string, class StorageClass) error {
+	return fmt.Errorf("s3 驱动暂不支持存储分层")
+}
+
+// Restore S3 驱动暂不支持存储分层
+func (s *S3Storage) Restore(id string, days int) error {
+	return fmt.Errorf("s3 驱动暂不支持存储分层")
+}
+
+// s3IsNotFound 判断 AWS SDK v2 返回的错误是否表示对象不存在
+func s3IsNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "NotFound") || strings.Contains(msg, "NoSuchKey") || strings.Contains(msg, "404")
+}
+
+// 注册 S3 兼容存储
+func init() {
+	RegisterStorage("s3", func() (Storage, error) {
+		endpoint := os.Getenv("S3_ENDPOINT")
+		region := os.Getenv("S3_REGION")
+		accessKey := os.Getenv("S3_ACCESS_KEY")
+		secretKey := os.Getenv("S3_SECRET_KEY")
+		bucket := os.Getenv("S3_BUCKET")
+		prefix := os.Getenv("S3_UPLOAD_PREFIX")
+		if prefix == "" {
+			prefix = "uploads/"
+		}
+		publicBaseURL := os.Getenv("CUSTOM_DOMAIN")
+		presignTTL := 0
+		if v, err := strconv.Atoi(os.Getenv("S3_PRESIGN_TTL")); err == nil {
+			presignTTL = v
+		}
+		return NewS3Storage(endpoint, region, accessKey, secretKey, bucket, prefix, publicBaseURL, time.Duration(presignTTL)*time.Second)
+	})
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// uploadSessionTTL 是断点续传会话在被后台 janitor 回收前允许闲置的最长时间
+const uploadSessionTTL = 24 * time.Hour
+
+// UploadSession 记录一次断点续传上传的进度，持久化在临时文件旁边，
+// 以便服务重启后仍能判断哪些分片已经确认写入。
+type UploadSession struct {
+	ID        string    `json:"id"`        // 会话ID；FinalizeChunked 落地的图片另行生成新的图片ID
+	Filename  string    `json:"filename"`  // 原始文件名
+	TotalSize int64     `json:"totalSize"` // 声明的文件总大小
+	ChunkSize int64     `json:"chunkSize"` // 分片大小
+	Received  []bool    `json:"received"`  // 按 ChunkSize 划分的分片位图，true 表示该分片已确认写入
+	CreatedAt time.Time `json:"createdAt"` // 会话创建时间
+	ExpiresAt time.Time `json:"expiresAt"` // 会话过期时间，过期后由 janitor 回收
+}
+
+// contiguousOffset 返回从文件头开始连续已接收的字节数，即客户端可安全续传的偏移量
+// （与 Received 位图本身允许乱序/空洞不同，tus.io 风格的 Upload-Offset 要求一段
+// 不间断的前缀）
+func (session *UploadSession) contiguousOffset() int64 {
+	offset := int64(0)
+	for i, received := range session.Received {
+		if !received {
+			break
+		}
+		chunkEnd := int64(i+1) * session.ChunkSize
+		if chunkEnd > session.TotalSize {
+			chunkEnd = session.TotalSize
+		}
+		offset = chunkEnd
+	}
+	return offset
+}
+
+// ErrUploadSessionNotFound 表示断点续传会话不存在
+var ErrUploadSessionNotFound = fmt.Errorf("上传会话不存在")
+
+// ErrUploadIncomplete 表示断点续传会话尚未接收完所有分片
+var ErrUploadIncomplete = fmt.Errorf("上传尚未完成，仍有分片缺失")
+
+func (s *LocalStorage) sessionPaths(id string) (metaPath, tmpPath string) {
+	dir := filepath.Join(s.basePath, "sessions")
+	return filepath.Join(dir, id+".json"), filepath.Join(dir, id+".tmp")
+}
+
+func (s *LocalStorage) loadSession(id string) (*UploadSession, error) {
+	metaPath, _ := s.sessionPaths(id)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, fmt.Errorf("无法读取会话元数据: %w", err)
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("无法解析会话元数据: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *LocalStorage) saveSession(session *UploadSession) error {
+	metaPath, _ := s.sessionPaths(session.ID)
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化会话元数据: %w", err)
+	}
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		return fmt.Errorf("无法写入会话元数据: %w", err)
+	}
+	return nil
+}
+
+// CreateUploadSession 创建一个断点续传会话，返回会话ID
+func (s *LocalStorage) CreateUploadSession(filename string, totalSize, chunkSize int64) (string, error) {
+	if totalSize <= 0 || chunkSize <= 0 {
+		return "", fmt.Errorf("totalSize 和 chunkSize 必须为正数")
+	}
+
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	id := generateID()
+	numChunks := (totalSize + chunkSize - 1) / chunkSize
+
+	now := time.Now()
+	session := &UploadSession{
+		ID:        id,
+		Filename:  filename,
+		TotalSize: totalSize,
+		ChunkSize: chunkSize,
+		Received:  make([]bool, numChunks),
+		CreatedAt: now,
+		ExpiresAt: now.Add(uploadSessionTTL),
+	}
+
+	_, tmpPath := s.sessionPaths(id)
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("无法创建临时文件: %w", err)
+	}
+	tmpFile.Close()
+
+	if err := s.saveSession(session); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// OpenChunk 返回一个写入指定偏移量的 WriteCloser。如果 offset 落在已接收的范围内
+// （客户端重传），会先将临时文件截断回 offset，并清除该点之后所有分片的"已接收"
+// 标记，避免截断后遗留一段不再与实际字节对应的孤儿尾部位图。
+func (s *LocalStorage) OpenChunk(sessionID string, offset int64) (io.WriteCloser, error) {
+	s.sessionMu.Lock()
+	session, err := s.loadSession(sessionID)
+	if err != nil {
+		s.sessionMu.Unlock()
+		return nil, err
+	}
+
+	if offset < 0 || offset > session.TotalSize {
+		s.sessionMu.Unlock()
+		return nil, fmt.Errorf("偏移量 %d 超出声明的总大小 %d", offset, session.TotalSize)
+	}
+
+	_, tmpPath := s.sessionPaths(sessionID)
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		s.sessionMu.Unlock()
+		return nil, fmt.Errorf("无法打开临时文件: %w", err)
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		s.sessionMu.Unlock()
+		return nil, fmt.Errorf("无法截断临时文件: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		s.sessionMu.Unlock()
+		return nil, fmt.Errorf("无法定位临时文件: %w", err)
+	}
+
+	// 截断会丢弃 offset 之后的所有字节，因此此前标记为已接收的分片不再成立
+	startIdx := offset / session.ChunkSize
+	for i := int(startIdx); i < len(session.Received); i++ {
+		session.Received[i] = false
+	}
+	if err := s.saveSession(session); err != nil {
+		file.Close()
+		s.sessionMu.Unlock()
+		return nil, err
+	}
+	s.sessionMu.Unlock()
+
+	return &chunkWriteCloser{
+		file:        file,
+		storage:     s,
+		sessionID:   sessionID,
+		startOffset: offset,
+	}, nil
+}
+
+// chunkWriteCloser 包装临时文件句柄，在 Close 时把实际写入的字节范围标记回会话位图
+type chunkWriteCloser struct {
+	file        *os.File
+	storage     *LocalStorage
+	sessionID   string
+	startOffset int64
+	written     int64
+}
+
+func (w *chunkWriteCloser) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *chunkWriteCloser) Close() error {
+	closeErr := w.file.Close()
+
+	w.storage.sessionMu.Lock()
+	defer w.storage.sessionMu.Unlock()
+
+	session, err := w.storage.loadSession(w.sessionID)
+	if err != nil {
+		if closeErr == nil {
+			closeErr = err
+		}
+		return closeErr
+	}
+
+	start := w.startOffset / session.ChunkSize
+	// 只标记完整写满的分片；最后一个分片以写到声明的总大小为准，写到一半中断的分片保持未接收
+	endByte := w.startOffset + w.written
+	end := endByte / session.ChunkSize
+	if endByte >= session.TotalSize {
+		end = int64(len(session.Received))
+	}
+	for i := start; i < end && int(i) < len(session.Received); i++ {
+		session.Received[i] = true
+	}
+
+	if err := w.storage.saveSession(session); err != nil && closeErr == nil {
+		closeErr = err
+	}
+
+	return closeErr
+}
+
+// FinalizeChunked 校验会话位图已完全覆盖声明的总大小，将临时文件作为原始图片落地，
+// 并清理会话元数据。返回的 ImageInfo 只包含存储层已知的字段（尺寸/格式等需解码后
+// 由调用方按 UploadHandler 的流程补全）。
+func (s *LocalStorage) FinalizeChunked(sessionID string) (*ImageInfo, error) {
+	s.sessionMu.Lock()
+	session, err := s.loadSession(sessionID)
+	if err != nil {
+		s.sessionMu.Unlock()
+		return nil, err
+	}
+
+	for _, received := range session.Received {
+		if !received {
+			s.sessionMu.Unlock()
+			return nil, ErrUploadIncomplete
+		}
+	}
+	s.sessionMu.Unlock()
+
+	_, tmpPath := s.sessionPaths(sessionID)
+	tmpFile, err := os.Open(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开已完成的临时文件: %w", err)
+	}
+	defer tmpFile.Close()
+
+	// 基于魔数嗅探校验组装后的内容确实是图片，而不是信任客户端上报的 filename，
+	// 避免把任意文件（例如伪装成图片分片上传的 HTML/JS）落地到公开的 /static 目录下；
+	// 与 v1 上传路径 (internal/api/upload.go) 的校验保持同等强度
+	sniffBuf := make([]byte, 512)
+	n, err := tmpFile.Read(sniffBuf)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("无法读取已组装文件用于内容嗅探: %w", err)
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("无法重置临时文件指针: %w", err)
+	}
+	if mimeType := http.DetectContentType(sniffBuf[:n]); !strings.HasPrefix(mimeType, "image/") {
+		_ = s.CancelUploadSession(sessionID)
+		return nil, fmt.Errorf("组装后的文件内容类型 %q 不是图片，已拒绝落地", mimeType)
+	}
+
+	id, err := s.Save(context.Background(), tmpFile, session.Filename, Original, Landscape)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.CancelUploadSession(sessionID); err != nil {
+		return nil, err
+	}
+
+	return &ImageInfo{
+		ID:        id,
+		Filename:  session.Filename,
+		Size:      session.TotalSize,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// CancelUploadSession 取消并清理一个未完成的断点续传会话
+func (s *LocalStorage) CancelUploadSession(sessionID string) error {
+	metaPath, tmpPath := s.sessionPaths(sessionID)
+
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("无法删除临时文件: %w", err)
+	}
+	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("无法删除会话元数据: %w", err)
+	}
+	return nil
+}
+
+// SessionOffset 返回会话当前可安全续传的偏移量（从头开始连续已接收的字节数）
+// 及声明的文件总大小，供 tus.io 风格的 HEAD 查询端点使用
+func (s *LocalStorage) SessionOffset(sessionID string) (offset int64, totalSize int64, err error) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	session, err := s.loadSession(sessionID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return session.contiguousOffset(), session.TotalSize, nil
+}
+
+// CleanExpiredSessions 回收所有已超过 TTL 仍未完成的断点续传会话，
+// 供后台 janitor 周期性调用，避免客户端异常中断后留下的临时文件无限堆积
+func (s *LocalStorage) CleanExpiredSessions() (int, error) {
+	dir := filepath.Join(s.basePath, "sessions")
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("无法读取会话目录: %w", err)
+	}
+
+	now := time.Now()
+	count := 0
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		id := strings.TrimSuffix(file.Name(), ".json")
+
+		s.sessionMu.Lock()
+		session, err := s.loadSession(id)
+		s.sessionMu.Unlock()
+		if err != nil {
+			continue
+		}
+
+		if session.ExpiresAt.After(now) {
+			continue
+		}
+
+		if err := s.CancelUploadSession(id); err == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
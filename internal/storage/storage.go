@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 )
@@ -20,6 +22,54 @@ type ImageInfo struct {
 	CreatedAt   time.Time `json:"createdAt"`   // 创建时间
 	ExpiresAt   time.Time `json:"expiresAt"`   // 过期时间（如果有）
 	HasExpiry   bool      `json:"hasExpiry"`   // 是否有过期时间
+	Thumbnails  []int     `json:"thumbnails"`  // 已生成的缩略图宽度列表，用于响应式 srcset
+	Frames      int       `json:"frames"`      // 动画帧数（静态图片为 1）
+	DurationMs  int       `json:"durationMs"`  // 动画总时长（毫秒），静态图片为 0
+
+	Formats []string `json:"formats,omitempty"` // 除 Original 外实际保存成功的派生格式（如 webp/avif/jxl），供删除时精确清理；旧记录可能为空
+
+	SHA256   string `json:"sha256,omitempty"` // 原始文件内容的 SHA-256，用于内容寻址去重，也可直接作为 ETag
+	RefCount int    `json:"refCount"`         // 引用计数：内容去重命中时递增，Delete 仅在计数降为 0 时物理删除
+	MIME     string `json:"mime,omitempty"`   // 基于魔数嗅探得到的真实 Content-Type，供下游 GET 处理器设置响应头
+
+	StorageClass  string    `json:"storageClass"`            // 存储层级，参见 StorageClass 常量；空值等同于 StorageClassStandard
+	RestoreStatus string    `json:"restoreStatus,omitempty"` // 冷层级图片的取回状态，参见 RestoreStatus 常量
+	RestoredUntil time.Time `json:"restoredUntil,omitempty"` // 取回的有效期截止时间
+}
+
+// StorageClass 表示图片所处的存储层级
+type StorageClass string
+
+const (
+	// StorageClassStandard 标准（热）层级
+	StorageClassStandard StorageClass = "standard"
+	// StorageClassInfrequent 低频访问层级
+	StorageClassInfrequent StorageClass = "infrequent"
+	// StorageClassArchive 归档层级
+	StorageClassArchive StorageClass = "archive"
+	// StorageClassDeepArchive 深度归档层级
+	StorageClassDeepArchive StorageClass = "deep_archive"
+)
+
+// RestoreStatus 表示冷层级图片的取回状态
+type RestoreStatus string
+
+const (
+	// RestoreStatusNone 尚未发起取回
+	RestoreStatusNone RestoreStatus = "none"
+	// RestoreStatusRestoring 取回进行中
+	RestoreStatusRestoring RestoreStatus = "restoring"
+	// RestoreStatusRestored 已取回，可在 RestoredUntil 之前正常读取
+	RestoreStatusRestored RestoreStatus = "restored"
+)
+
+// ErrObjectArchived 表示请求的图片处于冷层级且尚未（或不再）处于可读的取回窗口内
+type ErrObjectArchived struct {
+	RestoreStatus string
+}
+
+func (e *ErrObjectArchived) Error() string {
+	return fmt.Sprintf("图片已归档，当前取回状态为 %q，请先调用 Restore", e.RestoreStatus)
 }
 
 // ImageFormat 表示图片格式
@@ -32,8 +82,26 @@ const (
 	WebP ImageFormat = "webp"
 	// AVIF 格式
 	AVIF ImageFormat = "avif"
+	// JXL JPEG XL 格式
+	JXL ImageFormat = "jxl"
 )
 
+// defaultVariantFormats 是 Formats 字段为空（chunk2-6 之前写入的旧记录）时的历史默认值
+var defaultVariantFormats = []ImageFormat{WebP, AVIF}
+
+// VariantFormats 返回该图片 Original 之外实际保存过的派生格式（Formats 字段），
+// 为空时（旧记录）退回历史默认值 webp/avif。调用方按需自行处理 Original。
+func (info *ImageInfo) VariantFormats() []ImageFormat {
+	if len(info.Formats) == 0 {
+		return defaultVariantFormats
+	}
+	formats := make([]ImageFormat, len(info.Formats))
+	for i, f := range info.Formats {
+		formats[i] = ImageFormat(f)
+	}
+	return formats
+}
+
 // ImageOrientation 表示图片方向
 type ImageOrientation string
 
@@ -44,19 +112,31 @@ const (
 	Portrait ImageOrientation = "portrait"
 )
 
+// OriginalSize 表示保存/获取原始尺寸（未缩放）变体
+const OriginalSize = 0
+
 // Storage 定义存储接口
 type Storage interface {
-	// Save 保存图片
-	Save(reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error)
+	// Save 保存图片，生成新的图片ID，并以原始尺寸（width=0）写入。
+	// ctx 用于串联调用方的追踪 span，驱动可据此开出 storage.save 等子 span。
+	Save(ctx context.Context, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation) (string, error)
+
+	// SaveVariant 在已有图片ID下保存指定格式/尺寸的派生变体（例如不同编码格式的完整图或缩略图）。
+	// width 为 0（OriginalSize）表示完整尺寸，非 0 表示对应宽度的缩略图。
+	SaveVariant(ctx context.Context, id string, reader io.Reader, filename string, format ImageFormat, orientation ImageOrientation, width int) error
 
 	// Delete 删除图片
-	Delete(id string, format ImageFormat, orientation ImageOrientation) error
+	Delete(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) error
 
-	// Get 获取图片
-	Get(id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error)
+	// DeleteVariant 删除指定格式/尺寸的派生变体，width 为 0（OriginalSize）时等价于 Delete。
+	// 用于清理 SaveVariant 写入的缩略图变体，不支持按宽度细分变体的驱动可忽略 width。
+	DeleteVariant(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation, width int) error
 
-	// GetURL 获取图片URL
-	GetURL(id string, format ImageFormat, orientation ImageOrientation) string
+	// Get 获取图片。ctx 用于串联调用方的追踪 span，驱动可据此开出 storage.get 等子 span。
+	Get(ctx context.Context, id string, format ImageFormat, orientation ImageOrientation) (io.ReadCloser, error)
+
+	// GetURL 获取图片URL，width 为 0 表示原始尺寸，否则指向对应宽度的缩略图变体
+	GetURL(id string, format ImageFormat, orientation ImageOrientation, width int) string
 
 	// List 列出所有图片
 	List() ([]ImageInfo, error)
@@ -70,8 +150,38 @@ type Storage interface {
 	// DeleteInfo 删除图片信息
 	DeleteInfo(id string) error
 
-	// CleanExpired 清理过期图片
-	CleanExpired() (int, error)
+	// LookupByHash 按 SHA256 查找已存在的图片，供上传路径在写入前做内容去重；
+	// 第二个返回值表示是否命中，未命中时 error 应为 nil
+	LookupByHash(hash string) (*ImageInfo, bool, error)
+
+	// CleanExpired 清理过期图片。实现以 ctx 为父开出 storage.clean_expired 子 span，
+	// 并在清理完成后在该子 span 上记录一个携带清理数量的 span event。
+	CleanExpired(ctx context.Context) (int, error)
+
+	// CleanOrphans 清理没有对应元数据的孤立文件，以及没有对应文件的孤立元数据，
+	// 返回 (清理的孤立文件数, 清理的孤立元数据数, error)
+	CleanOrphans() (int, int, error)
+
+	// CreateUploadSession 创建一个断点续传会话，返回会话ID
+	CreateUploadSession(filename string, totalSize, chunkSize int64) (string, error)
+
+	// OpenChunk 返回用于写入指定偏移量数据块的 WriteCloser。如果该偏移量落在
+	// 已接收数据范围内（客户端重传），实现必须先将临时文件截断回该偏移量，
+	// 避免保留比确认字节更长的"孤儿尾部"。
+	OpenChunk(sessionID string, offset int64) (io.WriteCloser, error)
+
+	// FinalizeChunked 校验会话的数据块位图已完全覆盖声明的总大小，
+	// 将临时文件落地为原始图片并返回其基础元数据（不含尺寸/格式等需要解码才能获得的信息）
+	FinalizeChunked(sessionID string) (*ImageInfo, error)
+
+	// CancelUploadSession 取消并清理一个未完成的断点续传会话
+	CancelUploadSession(sessionID string) error
+
+	// SetStorageClass 调整图片的存储层级，驱动据此决定物理存放位置与可读性
+	SetStorageClass(id string, class StorageClass) error
+
+	// Restore 对冷层级图片发起取回，days 指定取回后的可读窗口天数
+	Restore(id string, days int) error
 }
 
 // StorageFactory 创建存储实例的工厂函数类型
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tierDir 返回指定格式/方向在热层级或冷层级（cold 子树）下的目录路径
+func (s *LocalStorage) tierDir(format ImageFormat, orientation ImageOrientation, cold bool) string {
+	if cold {
+		return filepath.Join(s.basePath, "cold", string(format), string(orientation))
+	}
+	if format == Original {
+		return filepath.Join(s.basePath, "original", string(orientation))
+	}
+	return filepath.Join(s.basePath, string(format), string(orientation))
+}
+
+// isCold 判断一个存储层级是否属于冷层级（非 StorageClassStandard）
+func isCold(class string) bool {
+	return class != "" && class != string(StorageClassStandard)
+}
+
+// SetStorageClass 调整图片的存储层级。从热层级迁往冷层级（或反向迁回）时，
+// 把该图片所有格式/方向变体的物理文件在 "cold/" 子树与常规目录之间整体搬迁，
+// 以此模拟真实对象存储的层级迁移。
+func (s *LocalStorage) SetStorageClass(id string, class StorageClass) error {
+	info, err := s.GetInfo(id)
+	if err != nil {
+		return err
+	}
+
+	fromCold := isCold(info.StorageClass)
+	toCold := isCold(string(class))
+
+	if fromCold != toCold {
+		orientation := ImageOrientation(info.Orientation)
+		formats := append([]ImageFormat{Original}, info.VariantFormats()...)
+		for _, format := range formats {
+			if err := s.moveTier(id, format, orientation, fromCold, toCold); err != nil && err != ErrFileNotFound {
+				return err
+			}
+		}
+	}
+
+	info.StorageClass = string(class)
+	if !toCold {
+		info.RestoreStatus = string(RestoreStatusNone)
+		info.RestoredUntil = time.Time{}
+	} else if info.RestoreStatus == "" {
+		info.RestoreStatus = string(RestoreStatusNone)
+	}
+
+	return s.SaveInfo(info)
+}
+
+// moveTier 把一个图片 id 在某个格式/方向下的所有文件（含缩略图尺寸变体）
+// 从一个层级目录搬迁到另一个层级目录
+func (s *LocalStorage) moveTier(id string, format ImageFormat, orientation ImageOrientation, fromCold, toCold bool) error {
+	fromDir := s.tierDir(format, orientation, fromCold)
+	toDir := s.tierDir(format, orientation, toCold)
+
+	matches, err := filepath.Glob(filepath.Join(fromDir, id+".*"))
+	if err != nil {
+		return fmt.Errorf("无法查找待迁移文件: %w", err)
+	}
+	moreMatches, err := filepath.Glob(filepath.Join(fromDir, id+"_*"))
+	if err != nil {
+		return fmt.Errorf("无法查找待迁移文件: %w", err)
+	}
+	matches = append(matches, moreMatches...)
+
+	if len(matches) == 0 {
+		return ErrFileNotFound
+	}
+
+	if err := os.MkdirAll(toDir, 0755); err != nil {
+		return fmt.Errorf("无法创建目标目录 %s: %w", toDir, err)
+	}
+
+	for _, src := range matches {
+		dst := filepath.Join(toDir, filepath.Base(src))
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("无法迁移文件 %s: %w", src, err)
+		}
+	}
+
+	return nil
+}
+
+// Restore 对冷层级图片发起取回，使其在接下来的 days 天内可正常读取。
+// 本地驱动同步完成取回（没有真实的跨层级延迟），直接将状态置为 restored。
+func (s *LocalStorage) Restore(id string, days int) error {
+	info, err := s.GetInfo(id)
+	if err != nil {
+		return err
+	}
+
+	if !isCold(info.StorageClass) {
+		return fmt.Errorf("图片不处于冷层级，无需取回")
+	}
+
+	if days <= 0 {
+		days = 1
+	}
+
+	info.RestoreStatus = string(RestoreStatusRestored)
+	info.RestoredUntil = time.Now().Add(time.Duration(days) * 24 * time.Hour)
+
+	return s.SaveInfo(info)
+}
+
+// SweepExpiredRestores 扫描所有图片，将取回窗口已过期的冷层级图片重新置为不可读状态，
+// 供后台调度器周期性调用
+func (s *LocalStorage) SweepExpiredRestores() (int, error) {
+	images, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	count := 0
+	for _, info := range images {
+		if info.RestoreStatus != string(RestoreStatusRestored) {
+			continue
+		}
+		if info.RestoredUntil.IsZero() || info.RestoredUntil.After(now) {
+			continue
+		}
+
+		info.RestoreStatus = string(RestoreStatusNone)
+		info.RestoredUntil = time.Time{}
+		if err := s.SaveInfo(&info); err == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
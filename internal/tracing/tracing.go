@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName 是上报给 OTLP 后端的服务名
+const serviceName = "infiniteimages"
+
+// Tracer 是贯穿中间件、API 处理器与存储驱动的全局 tracer。未调用 Init（或
+// 追踪未启用）时为 SDK 提供的 no-op 实现，调用方无需判空即可安全使用。
+var Tracer trace.Tracer = otel.Tracer(serviceName)
+
+// Init 根据配置初始化 OTLP exporter 与全局 TracerProvider。追踪未启用时
+// 返回一个空操作的 shutdown 函数，调用方始终可以无条件 defer 它。
+func Init(cfg *config.Config) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+
+	if !cfg.EnableTracing {
+		return noop, nil
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTELExporterEndpoint))
+	if err != nil {
+		return noop, fmt.Errorf("无法创建 OTLP 导出器: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return noop, fmt.Errorf("无法构建追踪 resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	Tracer = tp.Tracer(serviceName)
+
+	return tp.Shutdown, nil
+}
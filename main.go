@@ -13,8 +13,10 @@ import (
 
 	"github.com/emper0r/InfiniteImages/config"
 	"github.com/emper0r/InfiniteImages/internal/api"
+	"github.com/emper0r/InfiniteImages/internal/events"
 	"github.com/emper0r/InfiniteImages/internal/middleware"
 	"github.com/emper0r/InfiniteImages/internal/storage"
+	"github.com/emper0r/InfiniteImages/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -22,6 +24,7 @@ import (
 func main() {
 	// 解析命令行参数
 	configFile := flag.String("config", ".env", "配置文件路径")
+	migrateTo := flag.String("migrate-to", "", "一次性将本地存储迁移到指定远程后端（s3 或 oss）后退出，不启动 HTTP 服务")
 	flag.Parse()
 
 	// 加载环境变量
@@ -33,6 +36,14 @@ func main() {
 	// 加载配置
 	cfg := config.LoadConfig()
 
+	// 后台迁移命令：存在 -migrate-to 时只执行一次性迁移，不启动 HTTP 服务
+	if *migrateTo != "" {
+		if err := runStorageMigration(cfg, *migrateTo); err != nil {
+			log.Fatalf("迁移失败: %v", err)
+		}
+		return
+	}
+
 	// 设置运行模式
 	if !cfg.DebugMode {
 		gin.SetMode(gin.ReleaseMode)
@@ -44,10 +55,23 @@ func main() {
 		log.Fatalf("无法创建存储实例: %v", err)
 	}
 
+	// 构建存储注册表，供上传接口按 backend 表单字段在单次请求内选择非默认后端
+	registry := buildStorageRegistry(cfg, store)
+
+	// 初始化链路追踪（未启用时返回空操作的 shutdown）
+	shutdownTracing, err := tracing.Init(cfg)
+	if err != nil {
+		log.Printf("警告: 无法初始化链路追踪: %v", err)
+	}
+
+	// 创建图片生命周期事件总线（未启用 Kafka 时返回空操作实现）
+	bus := events.NewEventBus(cfg)
+
 	// 创建 Gin 引擎
 	r := gin.New()
 
-	// 使用自定义中间件
+	// 使用自定义中间件，Tracing 置于最前以便后续中间件/处理器都能取到 span context
+	r.Use(middleware.Tracing(cfg))
 	r.Use(middleware.Logger(cfg))
 	r.Use(middleware.CORS(cfg))
 	r.Use(middleware.IPFilter(cfg))
@@ -61,7 +85,16 @@ func main() {
 	r.StaticFile("/favicon.ico", "./static/favicon.ico")
 
 	// 设置 API 路由
-	setupRoutes(r, cfg, store)
+	setupRoutes(r, cfg, store, bus, registry)
+
+	// 启动孤立文件/元数据回收的后台调度器
+	go runOrphanGCScheduler(cfg, store)
+
+	// 启动取回窗口过期扫描的后台调度器
+	go runRestoreSweepScheduler(cfg, store)
+
+	// 启动断点续传会话的过期回收调度器
+	go runUploadSessionJanitor(store)
 
 	// 获取服务器地址
 	addr := cfg.ServerAddr
@@ -87,6 +120,15 @@ func main() {
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Fatal("服务器强制关闭:", err)
 		}
+
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("警告: 关闭链路追踪导出器失败: %v", err)
+		}
+
+		if err := bus.Close(ctx); err != nil {
+			log.Printf("警告: 关闭事件总线失败: %v", err)
+		}
+
 		log.Println("服务器已关闭")
 	}()
 
@@ -97,8 +139,122 @@ func main() {
 	}
 }
 
+// runOrphanGCScheduler 按配置的间隔周期性执行孤立文件/元数据回收
+func runOrphanGCScheduler(cfg *config.Config, store storage.Storage) {
+	if cfg.GCIntervalMinutes <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.GCIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		blobsRemoved, metadataRemoved, err := store.CleanOrphans()
+		if err != nil {
+			log.Printf("后台垃圾回收失败: %v", err)
+			continue
+		}
+		if blobsRemoved > 0 || metadataRemoved > 0 {
+			log.Printf("后台垃圾回收完成: 清理孤立文件 %d 个, 孤立元数据 %d 个", blobsRemoved, metadataRemoved)
+		}
+	}
+}
+
+// restoreSweeper 是能够扫描并回收过期取回窗口的存储驱动实现的可选接口
+type restoreSweeper interface {
+	SweepExpiredRestores() (int, error)
+}
+
+// runRestoreSweepScheduler 按固定间隔扫描一次，把取回窗口已过期的冷层级图片重新置为不可读，
+// 仅对实现了 restoreSweeper 的驱动（目前是本地存储）生效
+func runRestoreSweepScheduler(cfg *config.Config, store storage.Storage) {
+	sweeper, ok := store.(restoreSweeper)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := sweeper.SweepExpiredRestores()
+		if err != nil {
+			log.Printf("取回窗口扫描失败: %v", err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("取回窗口扫描完成: %d 张图片的取回状态已过期", count)
+		}
+	}
+}
+
+// sessionJanitor 是能够回收过期断点续传会话的存储驱动实现的可选接口，
+// 目前仅本地存储支持会话
+type sessionJanitor interface {
+	CleanExpiredSessions() (int, error)
+}
+
+// runUploadSessionJanitor 按固定间隔扫描一次，回收超过 TTL 仍未完成的断点续传会话，
+// 避免客户端异常中断后遗留的临时文件无限堆积
+func runUploadSessionJanitor(store storage.Storage) {
+	janitor, ok := store.(sessionJanitor)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := janitor.CleanExpiredSessions()
+		if err != nil {
+			log.Printf("断点续传会话回收失败: %v", err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("断点续传会话回收完成: 清理过期会话 %d 个", count)
+		}
+	}
+}
+
+// buildStorageRegistry 构建按名称路由到不同存储后端的注册表。cfg.StorageType 对应的
+// 主后端始终登记为 primary 实例本身；其余后端（local/s3/oss）仅在各自的配置齐全时
+// 才额外构造并登记，配置缺失时跳过而不中断启动，因为它们只是可选的请求级覆盖
+func buildStorageRegistry(cfg *config.Config, primary storage.Storage) *storage.Registry {
+	registry := storage.NewRegistry(cfg.StorageType)
+	registry.Register(cfg.StorageType, primary)
+
+	if cfg.StorageType != "local" {
+		if local, err := storage.NewLocalStorage(cfg.LocalStoragePath); err != nil {
+			log.Printf("警告: 无法为存储注册表初始化 local 后端: %v", err)
+		} else {
+			registry.Register("local", local)
+		}
+	}
+
+	if cfg.StorageType != "s3" && cfg.S3Endpoint != "" && cfg.S3AccessKey != "" && cfg.S3SecretKey != "" && cfg.S3Bucket != "" {
+		s3Store, err := storage.NewS3Storage(cfg.S3Endpoint, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Bucket, cfg.S3UploadPrefix, cfg.CustomDomain, time.Duration(cfg.S3PresignTTL)*time.Second)
+		if err != nil {
+			log.Printf("警告: 无法为存储注册表初始化 s3 后端: %v", err)
+		} else {
+			registry.Register("s3", s3Store)
+		}
+	}
+
+	if cfg.StorageType != "oss" && cfg.OSSEndpoint != "" && cfg.OSSAccessKeyID != "" && cfg.OSSAccessKeySecret != "" && cfg.OSSBucket != "" {
+		ossStore, err := storage.NewOSSStorage(cfg.OSSEndpoint, cfg.OSSAccessKeyID, cfg.OSSAccessKeySecret, cfg.OSSBucket, cfg.OSSUploadPrefix, cfg.OSSCustomDomain)
+		if err != nil {
+			log.Printf("警告: 无法为存储注册表初始化 oss 后端: %v", err)
+		} else {
+			registry.Register("oss", ossStore)
+		}
+	}
+
+	return registry
+}
+
 // setupRoutes 设置 API 路由
-func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
+func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage, bus events.EventBus, registry *storage.Registry) {
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -107,6 +263,20 @@ func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
 		})
 	})
 
+	// GridFS（及其他支持 Get 的后端）图片流式转发路由
+	r.GET("/gridfs/:id", api.GridFSStreamHandler(cfg, store))
+
+	// 链路追踪诊断端点，仅暴露当前追踪配置，供运维确认 exporter 是否按预期启用
+	r.GET("/debug/tracez", middleware.APIKeyAuth(cfg), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"enabled":  cfg.EnableTracing,
+				"endpoint": cfg.OTELExporterEndpoint,
+			},
+		})
+	})
+
 	// 公共 API 路由组
 	publicAPI := r.Group("/api")
 	{
@@ -147,7 +317,7 @@ func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
 			img := images[randomIndex]
 
 			// 获取图片URL
-			url := store.GetURL(img.ID, storage.Original, storage.ImageOrientation(img.Orientation))
+			url := store.GetURL(img.ID, storage.Original, storage.ImageOrientation(img.Orientation), storage.OriginalSize)
 
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
@@ -159,14 +329,32 @@ func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
 				},
 			})
 		})
+
+		// 阿里云 OSS 直传回调（由 OSS 服务端发起，使用其自身的 RSA-SHA1 签名校验，
+		// 不走 API Key 鉴权）
+		publicAPI.POST("/upload/callback", api.OSSUploadCallbackHandler(cfg, store))
 	}
 
 	// 受保护的 API 路由组
 	protectedAPI := r.Group("/api")
 	protectedAPI.Use(middleware.APIKeyAuth(cfg))
 	{
-		// 上传图片
-		protectedAPI.POST("/upload", api.UploadHandler(cfg, store))
+		// 上传图片，支持 backend 表单字段（local/s3/oss）按请求选择目标存储后端
+		protectedAPI.POST("/upload", api.UploadHandler(cfg, bus, registry))
+
+		// 上传图片（v2）：支持 preset/max_width/max_height/max_bytes/thumbnails 等表单字段，
+		// 返回结构化响应；v1 端点 /api/upload 单独保留，返回按格式名索引的 URL 映射
+		protectedAPI.POST("/v2/upload", api.UploadHandlerV2(cfg, store, bus))
+
+		// 阿里云 OSS 直传签名（浏览器凭此策略直接 PUT 到 OSS，绕过服务端字节转发）
+		protectedAPI.POST("/upload/policy", api.OSSUploadPolicyHandler(cfg))
+
+		// 断点续传会话
+		protectedAPI.POST("/upload/session", api.CreateUploadSessionHandler(cfg, store))
+		protectedAPI.PUT("/upload/session/:sid/chunk", api.UploadChunkHandler(cfg, store))
+		protectedAPI.HEAD("/upload/session/:sid", api.UploadSessionStatusHandler(cfg, store))
+		protectedAPI.POST("/upload/session/:sid/complete", api.CompleteUploadSessionHandler(cfg, store))
+		protectedAPI.DELETE("/upload/session/:sid", api.CancelUploadSessionHandler(cfg, store))
 
 		// 获取图片列表
 		protectedAPI.GET("/images", api.ListImagesHandler(cfg, store))
@@ -175,10 +363,32 @@ func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
 		protectedAPI.GET("/images/:id", api.GetImageHandler(cfg, store))
 
 		// 删除图片
-		protectedAPI.DELETE("/images/:id", api.DeleteImageHandler(cfg, store))
+		protectedAPI.DELETE("/images/:id", api.DeleteImageHandler(cfg, store, bus))
 
 		// 更新图片标签
-		protectedAPI.PUT("/images/:id/tags", api.UpdateTagsHandler(cfg, store))
+		protectedAPI.PUT("/images/:id/tags", api.UpdateTagsHandler(cfg, store, bus))
+
+		// 批量 ZIP 归档下载（同步响应）
+		protectedAPI.POST("/images/archive", api.ArchiveHandler(cfg, store))
+
+		// 批量 ZIP 归档下载（令牌两段式：先换取令牌，再凭令牌流式下载）
+		protectedAPI.POST("/archive", api.CreateArchiveTokenHandler(cfg, store))
+		protectedAPI.GET("/archive/:token", api.ArchiveByTokenHandler(cfg, store))
+
+		// 服务端裁剪
+		protectedAPI.POST("/images/:id/crop", api.CropHandler(cfg, store))
+
+		// 图片原始字节流式转发（GridFS 等后端的 GetURL 指向此路由）
+		protectedAPI.GET("/images/:id/raw", api.GridFSStreamHandler(cfg, store))
+
+		// 调整存储层级（标准/低频/归档/深度归档）
+		protectedAPI.PUT("/images/:id/storage-class", api.SetStorageClassHandler(cfg, store))
+
+		// 取回冷层级图片
+		protectedAPI.POST("/images/:id/restore", api.RestoreHandler(cfg, store))
+
+		// 手动触发孤立文件/元数据垃圾回收
+		protectedAPI.POST("/admin/gc", api.GCHandler(cfg, store))
 
 		// 获取系统配置
 		protectedAPI.GET("/config", func(c *gin.Context) {
@@ -200,7 +410,7 @@ func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
 
 		// 手动触发清理过期图片
 		protectedAPI.POST("/trigger-cleanup", func(c *gin.Context) {
-			count, err := store.CleanExpired()
+			count, err := store.CleanExpired(c.Request.Context())
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"success": false,
@@ -210,6 +420,14 @@ func setupRoutes(r *gin.Engine, cfg *config.Config, store storage.Storage) {
 				return
 			}
 
+			bus.Publish(c.Request.Context(), string(events.ImageExpiredCleanup), events.Event{
+				Type:      events.ImageExpiredCleanup,
+				Sequence:  events.NextSequence(),
+				Timestamp: time.Now(),
+				ActorIP:   c.ClientIP(),
+				Count:     count,
+			})
+
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
 				"message": fmt.Sprintf("成功清理 %d 张过期图片", count),
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/emper0r/InfiniteImages/config"
+	"github.com/emper0r/InfiniteImages/internal/storage"
+)
+
+// buildMigrationTarget 为 -migrate-to 命令行参数构造对应的远程存储实例，
+// 复用与 buildStorageRegistry 相同的配置字段
+func buildMigrationTarget(cfg *config.Config, target string) (storage.Storage, error) {
+	switch target {
+	case "s3":
+		return storage.NewS3Storage(cfg.S3Endpoint, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Bucket, cfg.S3UploadPrefix, cfg.CustomDomain, 0)
+	case "oss":
+		return storage.NewOSSStorage(cfg.OSSEndpoint, cfg.OSSAccessKeyID, cfg.OSSAccessKeySecret, cfg.OSSBucket, cfg.OSSUploadPrefix, cfg.OSSCustomDomain)
+	default:
+		return nil, fmt.Errorf("不支持的迁移目标 %q（仅支持 s3 或 oss）", target)
+	}
+}
+
+// runStorageMigration 将本地存储（cfg.LocalStoragePath）中的所有图片连同其各派生格式变体/
+// 缩略图流式拷贝到 target 指定的远程后端，并重写每条记录的 StoragePath，
+// 图片ID保持不变。由 main() 在解析到 -migrate-to 参数时同步执行一次，完成后进程退出，
+// 不启动 HTTP 服务；可安全重复执行（已存在于远程的对象会被覆盖写入）
+func runStorageMigration(cfg *config.Config, target string) error {
+	remote, err := buildMigrationTarget(cfg, target)
+	if err != nil {
+		return err
+	}
+
+	local, err := storage.NewLocalStorage(cfg.LocalStoragePath)
+	if err != nil {
+		return fmt.Errorf("无法打开本地存储: %w", err)
+	}
+
+	images, err := local.List()
+	if err != nil {
+		return fmt.Errorf("无法列出本地图片: %w", err)
+	}
+
+	ctx := context.Background()
+	migrated := 0
+	for _, info := range images {
+		orientation := storage.ImageOrientation(info.Orientation)
+		ext := filepath.Ext(info.Filename)
+
+		if err := copyLocalVariant(ctx, cfg.LocalStoragePath, remote, info.ID, storage.Original, orientation, storage.OriginalSize, ext); err != nil {
+			log.Printf("跳过 %s: 无法迁移原始图片: %v", info.ID, err)
+			continue
+		}
+
+		// 按 Formats 字段记录的实际派生格式迁移（旧记录退回 webp/avif），而不是只迁移
+		// WebP，避免 chunk2-6 起按请求产出的 AVIF/JXL 变体在迁移后静默丢失
+		for _, format := range info.VariantFormats() {
+			if err := copyLocalVariant(ctx, cfg.LocalStoragePath, remote, info.ID, format, orientation, storage.OriginalSize, ""); err != nil {
+				log.Printf("%s: 无法迁移 %s 完整图（可能本就不存在）: %v", info.ID, format, err)
+			}
+
+			for _, width := range info.Thumbnails {
+				if err := copyLocalVariant(ctx, cfg.LocalStoragePath, remote, info.ID, format, orientation, width, ""); err != nil {
+					log.Printf("%s: 无法迁移 %s 格式 %d 宽度缩略图: %v", info.ID, format, width, err)
+				}
+			}
+		}
+
+		migratedInfo := info
+		migratedInfo.StoragePath = fmt.Sprintf("%s/%s", target, info.ID)
+		if err := remote.SaveInfo(&migratedInfo); err != nil {
+			log.Printf("跳过 %s: 无法写入远程元数据: %v", info.ID, err)
+			continue
+		}
+
+		migrated++
+	}
+
+	log.Printf("迁移完成: 共 %d/%d 张图片已写入 %s", migrated, len(images), target)
+	return nil
+}
+
+// copyLocalVariant 按 LocalStorage 的目录布局直接打开磁盘文件（绕开 Storage.Get 不支持
+// 按宽度读取变体的限制），再通过 remote.SaveVariant 以相同的图片ID写入远程后端
+func copyLocalVariant(ctx context.Context, basePath string, remote storage.Storage, id string, format storage.ImageFormat, orientation storage.ImageOrientation, width int, ext string) error {
+	dir := string(format)
+	if format == storage.Original {
+		dir = "original"
+	} else {
+		ext = "." + string(format)
+	}
+
+	name := id + ext
+	if width > 0 {
+		name = fmt.Sprintf("%s_%d%s", id, width, ext)
+	}
+
+	path := filepath.Join(basePath, dir, string(orientation), name)
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("无法打开本地文件 %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return remote.SaveVariant(ctx, id, file, name, format, orientation, width)
+}
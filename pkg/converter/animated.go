@@ -0,0 +1,253 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/kettek/apng"
+)
+
+// AnimatedImage 保存多帧动画图片的完整帧序列和时序信息
+type AnimatedImage struct {
+	Frames   []image.Image // 每一帧（已按 Disposal 规则合成为完整画面）
+	DelaysMs []int         // 每一帧的播放时长（毫秒）
+}
+
+// TotalDurationMs 返回动画总播放时长（毫秒）
+func (a *AnimatedImage) TotalDurationMs() int {
+	total := 0
+	for _, d := range a.DelaysMs {
+		total += d
+	}
+	return total
+}
+
+// DecodeAnimated 尝试将原始字节解码为多帧动画（GIF 或 APNG）。
+// 单帧图片或无法识别为动画的数据返回 ok=false，调用方应回退到静态解码路径。
+func DecodeAnimated(raw []byte) (anim *AnimatedImage, format ImageFormat, ok bool) {
+	if g, err := gif.DecodeAll(bytes.NewReader(raw)); err == nil && len(g.Image) > 1 {
+		frames := compositeGIFFrames(g)
+		delays := make([]int, len(g.Delay))
+		for i := range g.Delay {
+			delays[i] = g.Delay[i] * 10 // GIF 延迟单位为 1/100 秒
+		}
+		return &AnimatedImage{Frames: frames, DelaysMs: delays}, GIF, true
+	}
+
+	if a, err := apng.DecodeAll(bytes.NewReader(raw)); err == nil && len(a.Frames) > 1 {
+		frames, delays := compositeAPNGFrames(a.Frames)
+		if len(frames) > 1 {
+			return &AnimatedImage{Frames: frames, DelaysMs: delays}, PNG, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// compositeGIFFrames 按各帧的 Disposal 方法将其合成到完整画布尺寸上，返回的每一帧
+// 都是独立的完整图像。GIF 帧本身可能只覆盖画布的一个子矩形，直接使用会导致
+// 之前合成的画面内容丢失，解码出花屏/错位的动画
+func compositeGIFFrames(g *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	frames := make([]image.Image, len(g.Image))
+
+	for i, frame := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		snapshot := image.NewRGBA(bounds)
+		draw.Draw(snapshot, bounds, canvas, bounds.Min, draw.Src)
+		frames[i] = snapshot
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			draw.Draw(canvas, bounds, previous, bounds.Min, draw.Src)
+		}
+	}
+
+	return frames
+}
+
+// compositeAPNGFrames 按各帧的 DisposeOp/BlendOp 将其合成到完整画布尺寸上，
+// 跳过仅用于初始化画布、不参与播放的默认帧（IsDefault），返回合成后的帧序列
+// 及其对应的延迟时间（毫秒），两者按下标一一对应
+func compositeAPNGFrames(apngFrames []apng.Frame) ([]image.Image, []int) {
+	if len(apngFrames) == 0 {
+		return nil, nil
+	}
+
+	canvasBounds := apngFrames[0].Image.Bounds()
+	fullBounds := image.Rect(0, 0, canvasBounds.Dx(), canvasBounds.Dy())
+	canvas := image.NewRGBA(fullBounds)
+
+	var frames []image.Image
+	var delays []int
+
+	for _, frame := range apngFrames {
+		frameBounds := frame.Image.Bounds()
+		dstRect := image.Rect(frame.XOffset, frame.YOffset,
+			frame.XOffset+frameBounds.Dx(), frame.YOffset+frameBounds.Dy())
+
+		if frame.IsDefault {
+			draw.Draw(canvas, dstRect, frame.Image, frameBounds.Min, draw.Src)
+			continue
+		}
+
+		var previous *image.RGBA
+		if frame.DisposeOp == apng.DISPOSE_OP_PREVIOUS {
+			previous = image.NewRGBA(fullBounds)
+			draw.Draw(previous, fullBounds, canvas, fullBounds.Min, draw.Src)
+		}
+
+		blendOp := draw.Over
+		if frame.BlendOp == apng.BLEND_OP_SOURCE {
+			blendOp = draw.Src
+		}
+		draw.Draw(canvas, dstRect, frame.Image, frameBounds.Min, blendOp)
+
+		snapshot := image.NewRGBA(fullBounds)
+		draw.Draw(snapshot, fullBounds, canvas, fullBounds.Min, draw.Src)
+		frames = append(frames, snapshot)
+
+		delayMs := 1000
+		if frame.DelayDenominator > 0 {
+			delayMs = int(float64(frame.DelayNumerator) / float64(frame.DelayDenominator) * 1000)
+		}
+		delays = append(delays, delayMs)
+
+		switch frame.DisposeOp {
+		case apng.DISPOSE_OP_BACKGROUND:
+			draw.Draw(canvas, dstRect, image.Transparent, image.Point{}, draw.Src)
+		case apng.DISPOSE_OP_PREVIOUS:
+			draw.Draw(canvas, fullBounds, previous, fullBounds.Min, draw.Src)
+		}
+	}
+
+	return frames, delays
+}
+
+// GetAnimatedImageInfo 返回动画图片的基本信息
+func GetAnimatedImageInfo(anim *AnimatedImage, format ImageFormat) ImageInfo {
+	info := GetImageInfo(anim.Frames[0], format)
+	info.Frames = len(anim.Frames)
+	info.DurationMs = anim.TotalDurationMs()
+	return info
+}
+
+// EncodeAnimated 将动画序列编码为目标格式（目前支持 WebP 与 AVIF 动画输出）
+func EncodeAnimated(anim *AnimatedImage, options ConvertOptions) ([]byte, error) {
+	switch options.Format {
+	case WebP:
+		return encodeAnimatedWebP(anim, options)
+	case AVIF:
+		return encodeAnimatedAVIF(anim, options)
+	default:
+		// 其余目标格式不支持动画，退化为首帧静态图
+		return encode(anim.Frames[0], options)
+	}
+}
+
+// encodeAnimatedWebP 使用外部 img2webp 工具合成动画 WebP
+func encodeAnimatedWebP(anim *AnimatedImage, options ConvertOptions) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "infiniteimages-webp")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{}
+	for i, frame := range anim.Frames {
+		framePath := filepath.Join(tmpDir, fmt.Sprintf("frame-%03d.png", i))
+		f, err := os.Create(framePath)
+		if err != nil {
+			return nil, fmt.Errorf("无法创建临时帧文件: %w", err)
+		}
+		if err := png.Encode(f, frame); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("无法编码临时帧: %w", err)
+		}
+		f.Close()
+
+		args = append(args, "-lossy", "-q", fmt.Sprintf("%d", options.Quality),
+			"-d", fmt.Sprintf("%d", anim.DelaysMs[i]), framePath)
+	}
+
+	outPath := filepath.Join(tmpDir, "output.webp")
+	args = append(args, "-o", outPath)
+
+	cmd := exec.Command("img2webp", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("img2webp 命令执行失败: %w, stderr: %s", err, stderr.String())
+	}
+
+	return os.ReadFile(outPath)
+}
+
+// encodeAnimatedAVIF 使用外部 avifenc 工具合成动画 AVIF
+func encodeAnimatedAVIF(anim *AnimatedImage, options ConvertOptions) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "infiniteimages-avif")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var framePaths []string
+	for i, frame := range anim.Frames {
+		framePath := filepath.Join(tmpDir, fmt.Sprintf("frame-%03d.png", i))
+		f, err := os.Create(framePath)
+		if err != nil {
+			return nil, fmt.Errorf("无法创建临时帧文件: %w", err)
+		}
+		if err := png.Encode(f, frame); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("无法编码临时帧: %w", err)
+		}
+		f.Close()
+		framePaths = append(framePaths, framePath)
+	}
+
+	outPath := filepath.Join(tmpDir, "output.avif")
+
+	args := append([]string{}, framePaths...)
+	args = append(args, "-o", outPath,
+		"-s", fmt.Sprintf("%d", options.CompressionLevel),
+		"--timescale", "1000",
+		"--duration", fmt.Sprintf("%d", anim.DelaysMs[0]))
+
+	if options.Lossless {
+		args = append(args, "--lossless")
+	} else {
+		args = append(args, "-q", fmt.Sprintf("%d", options.Quality))
+	}
+
+	cmd := exec.Command("avifenc", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("avifenc 命令执行失败: %w, stderr: %s", err, stderr.String())
+	}
+
+	return os.ReadFile(outPath)
+}
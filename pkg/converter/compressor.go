@@ -0,0 +1,306 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Compressor 定义将解码后的图片压缩为字节流的可插拔后端
+type Compressor interface {
+	// Compress 将图片压缩为字节流
+	Compress(img image.Image, options ConvertOptions) ([]byte, error)
+
+	// Stats 返回后端的使用统计信息，用于日志/监控
+	Stats() CompressorStats
+}
+
+// CompressorStats 描述压缩后端的运行状态
+type CompressorStats struct {
+	Name         string         // 后端名称
+	KeyUsage     map[string]int // 每个 key 的调用次数（仅外部后端有意义）
+	InvalidKeys  []string       // 已失效的 key 列表
+	FallbackUsed int            // 回退到本地编码器的次数
+}
+
+// compressorFactory 创建压缩后端实例的工厂函数类型
+type compressorFactory func() (Compressor, error)
+
+var (
+	compressorMu        sync.Mutex
+	compressorFactories = make(map[string]compressorFactory)
+)
+
+// RegisterCompressor 注册压缩后端类型
+func RegisterCompressor(name string, factory compressorFactory) {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+	compressorFactories[name] = factory
+}
+
+// GetCompressor 按名称获取压缩后端实例；未注册或创建失败时返回默认的本地编码器
+func GetCompressor(name string) Compressor {
+	if name == "" {
+		return defaultLocalCompressor
+	}
+
+	compressorMu.Lock()
+	factory, exists := compressorFactories[name]
+	compressorMu.Unlock()
+
+	if !exists {
+		return defaultLocalCompressor
+	}
+
+	compressor, err := factory()
+	if err != nil {
+		return defaultLocalCompressor
+	}
+	return compressor
+}
+
+// LocalCompressor 是默认的进程内压缩后端，直接复用现有的 encode 实现
+type LocalCompressor struct{}
+
+var defaultLocalCompressor = &LocalCompressor{}
+
+// Compress 使用进程内编码器压缩图片
+func (c *LocalCompressor) Compress(img image.Image, options ConvertOptions) ([]byte, error) {
+	return encode(img, options)
+}
+
+// Stats 本地后端没有可观测的统计信息
+func (c *LocalCompressor) Stats() CompressorStats {
+	return CompressorStats{Name: "local"}
+}
+
+// TinifyCompressor 将 PNG/JPEG 压缩请求转发给 TinyPNG 兼容的外部压缩服务，
+// 维护一个 API key 池以分摊速率限制，并在所有 key 耗尽时回退到本地编码器。
+type TinifyCompressor struct {
+	endpoint string
+	sem      chan struct{} // 限制并发请求数的信号量
+	local    Compressor
+
+	mu          sync.Mutex
+	keys        []string
+	nextIdx     int
+	invalid     map[string]bool
+	rateLimited map[string]time.Time // key -> 限流冷却截止时间
+	usage       map[string]int
+	fallback    int
+
+	httpClient *http.Client
+}
+
+const defaultTinifyEndpoint = "https://api.tinify.com/shrink"
+
+// tinifyRateLimitCooldown 是某个 key 收到 429 后暂停使用的时长，到期前 nextKey 会跳过它，
+// 避免在同一个 key 上无意义地反复重试
+const tinifyRateLimitCooldown = 60 * time.Second
+
+// NewTinifyCompressor 从换行分隔的 key 文件创建 TinifyCompressor，workers 控制最大并发请求数
+func NewTinifyCompressor(keysFilePath string, workers int) (*TinifyCompressor, error) {
+	keys, err := loadKeys(keysFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key 文件 %s 中没有可用的 key", keysFilePath)
+	}
+	if workers <= 0 {
+		workers = 4
+	}
+
+	return &TinifyCompressor{
+		endpoint:    defaultTinifyEndpoint,
+		sem:         make(chan struct{}, workers),
+		local:       defaultLocalCompressor,
+		keys:        keys,
+		invalid:     make(map[string]bool),
+		rateLimited: make(map[string]time.Time),
+		usage:       make(map[string]int),
+		httpClient:  &http.Client{},
+	}, nil
+}
+
+func loadKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 key 文件: %w", err)
+	}
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key := scanner.Text()
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("无法读取 key 文件: %w", err)
+	}
+	return keys, nil
+}
+
+// nextKey 按轮询方式返回下一个未失效且当前未处于限流冷却期的 key，
+// 全部 key 都失效或正在冷却时返回 false，调用方应回退到本地编码器
+func (t *TinifyCompressor) nextKey() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < len(t.keys); i++ {
+		idx := (t.nextIdx + i) % len(t.keys)
+		key := t.keys[idx]
+		if t.invalid[key] {
+			continue
+		}
+		if cooldownUntil, limited := t.rateLimited[key]; limited && now.Before(cooldownUntil) {
+			continue
+		}
+		t.nextIdx = (idx + 1) % len(t.keys)
+		return key, true
+	}
+	return "", false
+}
+
+func (t *TinifyCompressor) markInvalid(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.invalid[key] = true
+}
+
+// markRateLimited 将 key 标记为限流中，在 tinifyRateLimitCooldown 到期前 nextKey 会跳过它
+func (t *TinifyCompressor) markRateLimited(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rateLimited[key] = time.Now().Add(tinifyRateLimitCooldown)
+}
+
+func (t *TinifyCompressor) recordUsage(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage[key]++
+}
+
+func (t *TinifyCompressor) recordFallback() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fallback++
+}
+
+// Compress 只对 PNG/JPEG 有意义；其他格式直接回退到本地编码器
+func (t *TinifyCompressor) Compress(img image.Image, options ConvertOptions) ([]byte, error) {
+	if options.Format != PNG && options.Format != JPEG {
+		return t.local.Compress(img, options)
+	}
+
+	srcData, err := encode(img, options)
+	if err != nil {
+		return nil, err
+	}
+
+	t.sem <- struct{}{}
+	defer func() { <-t.sem }()
+
+	for {
+		key, ok := t.nextKey()
+		if !ok {
+			t.recordFallback()
+			return t.local.Compress(img, options)
+		}
+
+		data, status, err := t.shrink(key, srcData)
+		if err != nil {
+			t.recordFallback()
+			return t.local.Compress(img, options)
+		}
+
+		switch status {
+		case http.StatusOK, http.StatusCreated:
+			t.recordUsage(key)
+			return data, nil
+		case http.StatusTooManyRequests:
+			// 当前 key 被限流，标记冷却并轮换到下一个；nextKey 会在所有 key
+			// 都失效或处于冷却期时返回 false，从而触发下面的本地编码器回退
+			t.markRateLimited(key)
+			continue
+		case http.StatusUnauthorized:
+			t.markInvalid(key)
+			continue
+		default:
+			t.recordFallback()
+			return t.local.Compress(img, options)
+		}
+	}
+}
+
+func (t *TinifyCompressor) shrink(key string, data []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("无法构建压缩请求: %w", err)
+	}
+	req.SetBasicAuth("api", key)
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("压缩请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, resp.StatusCode, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("无法读取压缩响应: %w", err)
+	}
+
+	return body, resp.StatusCode, nil
+}
+
+// Stats 返回各 key 的调用次数、已失效的 key 以及回退次数
+func (t *TinifyCompressor) Stats() CompressorStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := make(map[string]int, len(t.usage))
+	for k, v := range t.usage {
+		usage[k] = v
+	}
+
+	var invalidKeys []string
+	for k, v := range t.invalid {
+		if v {
+			invalidKeys = append(invalidKeys, k)
+		}
+	}
+
+	return CompressorStats{
+		Name:         "tinify",
+		KeyUsage:     usage,
+		InvalidKeys:  invalidKeys,
+		FallbackUsed: t.fallback,
+	}
+}
+
+// 注册 tinify 压缩后端
+func init() {
+	RegisterCompressor("tinify", func() (Compressor, error) {
+		keysFile := os.Getenv("TINIFY_KEYS_FILE")
+		if keysFile == "" {
+			return nil, fmt.Errorf("未配置 TINIFY_KEYS_FILE")
+		}
+		workers := 4
+		return NewTinifyCompressor(keysFile, workers)
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
 )
 
 // ImageFormat 表示图片格式
@@ -30,6 +31,8 @@ const (
 	WebP ImageFormat = "webp"
 	// AVIF 格式
 	AVIF ImageFormat = "avif"
+	// JXL JPEG XL 格式
+	JXL ImageFormat = "jxl"
 )
 
 // ImageInfo 存储图片的基本信息
@@ -38,6 +41,8 @@ type ImageInfo struct {
 	Height      int         // 图片高度
 	Format      ImageFormat // 图片格式
 	Orientation string      // 图片方向（横向/纵向）
+	Frames      int         // 动画帧数（静态图片为 1）
+	DurationMs  int         // 动画总时长（毫秒），静态图片为 0
 }
 
 // ConvertOptions 定义图片转换选项
@@ -47,7 +52,13 @@ type ConvertOptions struct {
 	CompressionLevel int         // 压缩级别（1-10）
 	Lossless         bool        // 是否无损压缩
 	Width            int         // 目标宽度（0表示保持原始宽度）
-	Height           int         // 目标高度（0表示保持原始高度）
+	Height           int         // 目标高度（为 0 且提供了 Width 时按原始宽高比推算；与 Width 同时提供时直接缩放到给定宽高，不保持宽高比）
+	Thumbnails       []int       // 需要一并生成的缩略图宽度列表（例如 []int{128, 256, 512, 1024}）
+	CropX            int         // 裁剪区域左上角 X 坐标
+	CropY            int         // 裁剪区域左上角 Y 坐标
+	CropW            int         // 裁剪区域宽度（0表示不裁剪）
+	CropH            int         // 裁剪区域高度（0表示不裁剪）
+	Backend          string      // 压缩后端名称（空字符串或 "local" 表示进程内编码器，例如 "tinify" 启用外部压缩服务）
 }
 
 // DefaultOptions 返回默认的转换选项
@@ -59,6 +70,7 @@ func DefaultOptions() ConvertOptions {
 		Lossless:         false,
 		Width:            0,
 		Height:           0,
+		Thumbnails:       nil,
 	}
 }
 
@@ -106,17 +118,111 @@ func GetImageInfo(img image.Image, format ImageFormat) ImageInfo {
 		Height:      height,
 		Format:      format,
 		Orientation: orientation,
+		Frames:      1,
 	}
 }
 
-// Convert 将图片转换为指定格式
-func Convert(img image.Image, options ConvertOptions) ([]byte, error) {
-	// 调整图片大小（如果需要）
-	if options.Width > 0 && options.Height > 0 {
-		img = resize(img, options.Width, options.Height)
+// prepareTarget 依次应用裁剪与缩放，返回供编码使用的主图目标，以及缩略图应使用的源图像
+// （已裁剪但未应用主图缩放）。Convert 与 ConvertMulti 共用这一步，裁剪/缩放与目标编码格式
+// 无关，只需执行一次。缩略图必须从 thumbSource 而非 target 生成：options.Width/Height 可能
+// 小于某些请求的缩略图宽度（例如 preset=thumb 的 320px 主图配合默认的 1024px 缩略图），
+// 若从已缩小的 target 生成会被无脑放大，产生模糊的"缩略图"。
+func prepareTarget(img image.Image, options ConvertOptions) (target image.Image, thumbSource image.Image, err error) {
+	thumbSource = img
+	if options.CropW > 0 && options.CropH > 0 {
+		cropped, err := crop(thumbSource, options.CropX, options.CropY, options.CropW, options.CropH)
+		if err != nil {
+			return nil, nil, err
+		}
+		thumbSource = cropped
 	}
 
-	// 根据目标格式进行转换
+	target = thumbSource
+	if options.Width > 0 || options.Height > 0 {
+		target = resize(thumbSource, options.Width, options.Height)
+	}
+
+	return target, thumbSource, nil
+}
+
+// Convert 将图片转换为指定格式，返回主图数据以及（如果指定了 Thumbnails）按宽度索引的缩略图数据
+func Convert(img image.Image, options ConvertOptions) ([]byte, map[int][]byte, error) {
+	target, thumbSource, err := prepareTarget(img, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	compressor := GetCompressor(options.Backend)
+	data, err := compressor.Compress(target, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 生成缩略图
+	var thumbnails map[int][]byte
+	if len(options.Thumbnails) > 0 {
+		thumbnails = make(map[int][]byte, len(options.Thumbnails))
+		for _, width := range options.Thumbnails {
+			if width <= 0 {
+				continue
+			}
+			thumbImg := resize(thumbSource, width, 0)
+			thumbData, err := compressor.Compress(thumbImg, options)
+			if err != nil {
+				return nil, nil, fmt.Errorf("生成 %d 宽度缩略图失败: %w", width, err)
+			}
+			thumbnails[width] = thumbData
+		}
+	}
+
+	return data, thumbnails, nil
+}
+
+// ConvertMulti 与 Convert 类似，但一次性编码为 formats 中的每种目标格式，裁剪/缩放只执行一次
+// 并在各格式间共享。用于同一张上传图片按调用方指定的多种编码格式（例如 webp/avif/jxl）产出变体。
+func ConvertMulti(img image.Image, formats []ImageFormat, options ConvertOptions) (map[ImageFormat][]byte, map[ImageFormat]map[int][]byte, error) {
+	target, thumbSource, err := prepareTarget(img, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := make(map[ImageFormat][]byte, len(formats))
+	thumbnails := make(map[ImageFormat]map[int][]byte, len(formats))
+
+	for _, format := range formats {
+		formatOptions := options
+		formatOptions.Format = format
+		compressor := GetCompressor(formatOptions.Backend)
+
+		encoded, err := compressor.Compress(target, formatOptions)
+		if err != nil {
+			return nil, nil, fmt.Errorf("编码为 %s 失败: %w", format, err)
+		}
+		data[format] = encoded
+
+		if len(options.Thumbnails) == 0 {
+			continue
+		}
+		formatThumbnails := make(map[int][]byte, len(options.Thumbnails))
+		for _, width := range options.Thumbnails {
+			if width <= 0 {
+				continue
+			}
+			thumbImg := resize(thumbSource, width, 0)
+			thumbData, err := compressor.Compress(thumbImg, formatOptions)
+			if err != nil {
+				return nil, nil, fmt.Errorf("生成 %s 格式 %d 宽度缩略图失败: %w", format, width, err)
+			}
+			formatThumbnails[width] = thumbData
+		}
+		thumbnails[format] = formatThumbnails
+	}
+
+	return data, thumbnails, nil
+}
+
+// encode 按目标格式编码单张图片
+func encode(img image.Image, options ConvertOptions) ([]byte, error) {
 	var buf bytes.Buffer
 	var err error
 
@@ -135,6 +241,9 @@ func Convert(img image.Image, options ConvertOptions) ([]byte, error) {
 	case AVIF:
 		// AVIF 需要使用外部命令行工具
 		return convertToAVIF(img, options)
+	case JXL:
+		// JPEG XL 需要使用外部命令行工具
+		return convertToJXL(img, options)
 	default:
 		return nil, fmt.Errorf("不支持的目标格式: %s", options.Format)
 	}
@@ -146,35 +255,144 @@ func Convert(img image.Image, options ConvertOptions) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// ConvertFromReader 从 Reader 读取图片并转换为指定格式
-func ConvertFromReader(reader io.Reader, options ConvertOptions) ([]byte, ImageInfo, error) {
+// ConvertFromReader 从 Reader 读取图片并转换为指定格式，同时返回按宽度索引的缩略图数据。
+// 对于多帧 GIF/APNG，目标格式为 WebP/AVIF 时保留完整动画序列，其余目标格式退化为首帧静态图；
+// 动画路径不应用裁剪与缩放选项，也不生成缩略图（返回的缩略图为 nil）。
+func ConvertFromReader(reader io.Reader, options ConvertOptions) ([]byte, map[int][]byte, ImageInfo, error) {
+	// 先整体读入内存，以便同时尝试动画探测和静态解码
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, ImageInfo{}, fmt.Errorf("无法读取图片数据: %w", err)
+	}
+
+	if anim, format, ok := DecodeAnimated(raw); ok {
+		info := GetAnimatedImageInfo(anim, format)
+		data, err := EncodeAnimated(anim, options)
+		if err != nil {
+			return nil, nil, info, err
+		}
+		info.Format = options.Format
+		return data, nil, info, nil
+	}
+
 	// 检测图片格式
-	format, img, err := DetectFormat(reader)
+	format, img, err := DetectFormat(bytes.NewReader(raw))
 	if err != nil {
-		return nil, ImageInfo{}, err
+		return nil, nil, ImageInfo{}, err
 	}
 
 	// 获取图片信息
 	info := GetImageInfo(img, format)
 
 	// 转换图片
-	data, err := Convert(img, options)
+	data, thumbnails, err := Convert(img, options)
 	if err != nil {
-		return nil, info, err
+		return nil, nil, info, err
 	}
 
 	// 更新图片信息中的格式
 	info.Format = options.Format
 
-	return data, info, nil
+	return data, thumbnails, info, nil
 }
 
-// 调整图片大小
+// ConvertFromReaderMulti 与 ConvertFromReader 类似，但从 Reader 读取图片后按 formats 分别转换，
+// 返回按格式索引的主图/缩略图数据。对于多帧 GIF/APNG，逐个格式调用 EncodeAnimated，
+// 不支持动画编码的格式会退化为首帧静态图（见 EncodeAnimated 的说明）。
+func ConvertFromReaderMulti(reader io.Reader, formats []ImageFormat, options ConvertOptions) (map[ImageFormat][]byte, map[ImageFormat]map[int][]byte, ImageInfo, error) {
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, ImageInfo{}, fmt.Errorf("无法读取图片数据: %w", err)
+	}
+
+	if anim, animFormat, ok := DecodeAnimated(raw); ok {
+		info := GetAnimatedImageInfo(anim, animFormat)
+
+		data := make(map[ImageFormat][]byte, len(formats))
+		for _, format := range formats {
+			formatOptions := options
+			formatOptions.Format = format
+			encoded, err := EncodeAnimated(anim, formatOptions)
+			if err != nil {
+				return nil, nil, info, err
+			}
+			data[format] = encoded
+		}
+		if len(formats) > 0 {
+			info.Format = formats[0]
+		}
+		return data, nil, info, nil
+	}
+
+	format, img, err := DetectFormat(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, ImageInfo{}, err
+	}
+
+	info := GetImageInfo(img, format)
+
+	data, thumbnails, err := ConvertMulti(img, formats, options)
+	if err != nil {
+		return nil, nil, info, err
+	}
+
+	if len(formats) > 0 {
+		info.Format = formats[0]
+	}
+
+	return data, thumbnails, info, nil
+}
+
+// crop 从图片中截取指定矩形区域，坐标/尺寸必须完全落在原图范围内
+func crop(img image.Image, x, y, width, height int) (image.Image, error) {
+	bounds := img.Bounds()
+	rect := image.Rect(bounds.Min.X+x, bounds.Min.Y+y, bounds.Min.X+x+width, bounds.Min.Y+y+height)
+
+	if !rect.In(bounds) {
+		return nil, fmt.Errorf("裁剪区域超出图片范围")
+	}
+
+	type subImager interface {
+		SubImage(r image.Rectangle) image.Image
+	}
+
+	si, ok := img.(subImager)
+	if !ok {
+		return nil, fmt.Errorf("图片类型不支持裁剪")
+	}
+
+	return si.SubImage(rect), nil
+}
+
+// resize 使用 CatmullRom 插值调整图片大小，当只提供一个维度时按原始宽高比计算另一个维度
 func resize(img image.Image, width, height int) image.Image {
-	// 这里简单实现，实际项目中应该使用更高质量的调整算法
-	// 例如使用 github.com/nfnt/resize 或 github.com/disintegration/imaging
-	// 这里仅作为示例
-	return img
+	bounds := img.Bounds()
+	srcWidth := bounds.Dx()
+	srcHeight := bounds.Dy()
+
+	if srcWidth == 0 || srcHeight == 0 {
+		return img
+	}
+
+	if width <= 0 && height <= 0 {
+		return img
+	}
+
+	if width <= 0 {
+		width = int(float64(height) * float64(srcWidth) / float64(srcHeight))
+	}
+	if height <= 0 {
+		height = int(float64(width) * float64(srcHeight) / float64(srcWidth))
+	}
+
+	if width == srcWidth && height == srcHeight {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	return dst
 }
 
 // 将图片转换为 AVIF 格式（使用外部命令行工具）
@@ -233,6 +451,57 @@ func convertToAVIF(img image.Image, options ConvertOptions) ([]byte, error) {
 	return avifData, nil
 }
 
+// 将图片转换为 JPEG XL 格式（使用外部命令行工具 cjxl）
+func convertToJXL(img image.Image, options ConvertOptions) ([]byte, error) {
+	// 创建临时文件
+	tmpDir, err := os.MkdirTemp("", "infiniteimages-jxl")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 将图片保存为 PNG
+	pngPath := filepath.Join(tmpDir, "input.png")
+	pngFile, err := os.Create(pngPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时 PNG 文件: %w", err)
+	}
+
+	if err := png.Encode(pngFile, img); err != nil {
+		pngFile.Close()
+		return nil, fmt.Errorf("无法编码 PNG 文件: %w", err)
+	}
+	pngFile.Close()
+
+	// 输出 JXL 路径
+	jxlPath := filepath.Join(tmpDir, "output.jxl")
+
+	// 构建命令
+	args := []string{pngPath, jxlPath, "-e", fmt.Sprintf("%d", options.CompressionLevel)}
+	if options.Lossless {
+		args = append(args, "-d", "0")
+	} else {
+		args = append(args, "-q", fmt.Sprintf("%d", options.Quality))
+	}
+
+	// 执行命令
+	cmd := exec.Command("cjxl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cjxl 命令执行失败: %w, stderr: %s", err, stderr.String())
+	}
+
+	// 读取生成的 JXL 文件
+	jxlData, err := os.ReadFile(jxlPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取生成的 JXL 文件: %w", err)
+	}
+
+	return jxlData, nil
+}
+
 // FormatFromExtension 从文件扩展名获取图片格式
 func FormatFromExtension(filename string) ImageFormat {
 	ext := strings.ToLower(filepath.Ext(filename))
@@ -247,6 +516,8 @@ func FormatFromExtension(filename string) ImageFormat {
 		return WebP
 	case ".avif":
 		return AVIF
+	case ".jxl":
+		return JXL
 	default:
 		return ""
 	}
@@ -265,6 +536,8 @@ func ExtensionFromFormat(format ImageFormat) string {
 		return ".webp"
 	case AVIF:
 		return ".avif"
+	case JXL:
+		return ".jxl"
 	default:
 		return ""
 	}
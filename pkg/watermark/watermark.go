@@ -2,6 +2,7 @@ package watermark
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/color"
@@ -10,6 +11,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/emper0r/InfiniteImages/internal/tracing"
 	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
@@ -87,8 +89,12 @@ func AddWatermark(img image.Image, options Options) (image.Image, error) {
 	}
 }
 
-// AddWatermarkFromReader 从 Reader 读取图片并添加水印
-func AddWatermarkFromReader(reader io.Reader, options Options) ([]byte, error) {
+// AddWatermarkFromReader 从 Reader 读取图片并添加水印。ctx 用于串联调用方的追踪 span，
+// 开出一个 watermark.encode 子 span。
+func AddWatermarkFromReader(ctx context.Context, reader io.Reader, options Options) ([]byte, error) {
+	_, span := tracing.Tracer.Start(ctx, "watermark.encode")
+	defer span.End()
+
 	// 解码图片
 	img, _, err := image.Decode(reader)
 	if err != nil {